@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+)
+
+// maxAuditArgLength bounds how much of each argument an audit entry keeps, so printing a large
+// list doesn't copy it into the log.
+const maxAuditArgLength = 64
+
+// auditEntry is one line of an audit log: a call to a native with side effects.
+type auditEntry struct {
+	Time   string   `json:"time"`
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Native string   `json:"native"`
+	Args   []string `json:"args"`
+}
+
+// summarizeArg renders a native argument for the audit log, cut short if it is long.
+func summarizeArg(arg interp.Value) string {
+	s := []rune(interp.FormatValue(arg))
+	if len(s) > maxAuditArgLength {
+		return string(s[:maxAuditArgLength]) + "..."
+	}
+	return string(s)
+}
+
+// startAuditLog makes vm append a JSON line to output for each call of a native with side
+// effects, and returns a function that closes the log.
+func startAuditLog(vm *interp.VM, filename string, output string) func() {
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		reportError(diag.FileError, "Could not open audit log: %v", err)
+		os.Exit(1)
+	}
+	vm.OnNativeCall(func(native *interp.NativeFunction, args []interp.Value, line int) {
+		writeAuditEntry(file, filename, native, args, line)
+	})
+	return func() {
+		if err := file.Close(); err != nil {
+			reportError(diag.FileError, "Could not write audit log: %v", err)
+		}
+	}
+}
+
+// writeAuditEntry writes the entry before the native runs, so natives that end the program, like
+// exit, are logged too. Failing to log stops the program: an audit log must not miss calls.
+func writeAuditEntry(w io.Writer, filename string, native *interp.NativeFunction, args []interp.Value, line int) {
+	summaries := make([]string, 0, len(args))
+	for _, arg := range args {
+		summaries = append(summaries, summarizeArg(arg))
+	}
+	entry, err := json.Marshal(auditEntry{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		File:   filename,
+		Line:   line,
+		Native: native.Name,
+		Args:   summaries,
+	})
+	if err == nil {
+		_, err = w.Write(append(entry, '\n'))
+	}
+	if err != nil {
+		reportError(diag.FileError, "Could not write audit log: %v", err)
+		os.Exit(1)
+	}
+}
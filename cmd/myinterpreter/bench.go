@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// benchRun compiles and executes tokens once, exiting on runtime errors since every iteration
+// would fail the same way.
+func benchRun(tokens []scanner.Token) {
+	ctx := context.Background()
+	_, err := interp.NewVM(interp.Limits{}).Run(ctx, compileTokens(ctx, tokens, false))
+	if err != nil {
+		if code, ok := reportRunError(err); ok {
+			os.Exit(code)
+		}
+		reportError(diag.RuntimeError, "%v", err)
+		os.Exit(1)
+	}
+}
+
+// bench times compiling and running an already scanned program. Warmup runs are discarded.
+func bench(tokens []scanner.Token, iterations int, warmup int) {
+	for i := 0; i < warmup; i++ {
+		benchRun(tokens)
+	}
+
+	var before, after runtime.MemStats
+	durations := make([]time.Duration, 0, iterations)
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		benchRun(tokens)
+		durations = append(durations, time.Since(start))
+	}
+	runtime.ReadMemStats(&after)
+
+	minimum, maximum, total := durations[0], durations[0], time.Duration(0)
+	for _, duration := range durations {
+		minimum = min(minimum, duration)
+		maximum = max(maximum, duration)
+		total += duration
+	}
+
+	fmt.Printf("iterations: %d (warmup %d)\n", iterations, warmup)
+	fmt.Printf("min: %v\n", minimum)
+	fmt.Printf("avg: %v\n", total/time.Duration(iterations))
+	fmt.Printf("max: %v\n", maximum)
+	fmt.Printf("allocs/op: %d\n", (after.Mallocs-before.Mallocs)/uint64(iterations))
+	fmt.Printf("bytes/op: %d\n", (after.TotalAlloc-before.TotalAlloc)/uint64(iterations))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// mustParse parses tokens into an expression, reporting syntax errors and exiting 65 on them.
+func mustParse(ctx context.Context, tokens []scanner.Token) (*parser.Parser, ast.Expr) {
+	p := parser.New(ctx, tokens)
+	expr, err := p.Parse()
+	if err != nil {
+		exitOnTimeout(err)
+		if !reporter.ReportError(err) {
+			reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.ExpectExpression, Message: err.Error(), Line: lastLine(tokens)})
+		}
+		os.Exit(65)
+	}
+	return p, expr
+}
+
+// lastLine is the line of the last token, 1 when there are none.
+func lastLine(tokens []scanner.Token) int {
+	if len(tokens) == 0 {
+		return 1
+	}
+	return tokens[len(tokens)-1].Line
+}
+
+// parse prints the AST of tokens as an S-expression, or as a Graphviz graph with format "dot".
+func parse(tokens []scanner.Token, format string) {
+	_, expr := mustParse(context.Background(), tokens)
+	if format == "dot" {
+		fmt.Print(printDot(expr))
+		return
+	}
+	fmt.Println(ast.Print(expr))
+}
+
+func reportEliminated(p *parser.Parser, compiler *interp.Compiler) {
+	for _, expr := range compiler.Eliminated {
+		reporter.Report(&diag.Diagnostic{
+			Severity: diag.Warning,
+			Code:     diag.UnreachableCode,
+			Message:  "removed unreachable code: " + ast.Print(expr),
+			Line:     p.Line(expr),
+		})
+	}
+}
+
+// compileTokens parses and compiles tokens into a chunk, exiting on errors. Warnings are reported
+// with verbose, and with --Werror they are errors that stop compilation.
+func compileTokens(ctx context.Context, tokens []scanner.Token, verbose bool) *interp.Chunk {
+	p, expr := mustParse(ctx, tokens)
+	compiler := interp.NewCompiler(p)
+	chunk, err := compiler.Compile(expr)
+	if err != nil {
+		if !reporter.ReportError(err) {
+			reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.CompileLimit, Message: err.Error(), Line: lastLine(tokens)})
+		}
+		os.Exit(65)
+	}
+	if verbose || reporter.WarningsAsErrors {
+		reportEliminated(p, compiler)
+	}
+	if reporter.WarningsAsErrors && len(compiler.Eliminated) > 0 {
+		os.Exit(65)
+	}
+	return interp.Optimize(chunk)
+}
+
+func compile(tokens []scanner.Token, name string, verbose bool, output string) {
+	chunk := compileTokens(context.Background(), tokens, verbose)
+	if output == "" {
+		fmt.Print(chunk.Disassemble(name))
+		return
+	}
+
+	if err := interp.WriteChunkFile(chunk, output); err != nil {
+		reportError(diag.FileError, "Could not write bytecode: %v", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, vm *interp.VM, chunk *interp.Chunk) error {
+	value, err := vm.Run(ctx, chunk)
+	if err != nil {
+		return err
+	}
+	fmt.Println(interp.FormatValue(value))
+	return nil
+}
+
+// exitOnTimeout exits like a VM limit error when err comes from a cancelled or expired context
+// while scanning or parsing.
+func exitOnTimeout(err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.LimitExceeded, Message: interp.TimeoutMessage})
+		os.Exit(75)
+	}
+}
+
+func exitOnRunError(err error) {
+	if err == nil {
+		return
+	}
+	if code, ok := reportRunError(err); ok {
+		os.Exit(code)
+	}
+	reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.RuntimeError, Message: err.Error()})
+	os.Exit(70)
+}
+
+// reportRunError reports a runtime or limit error and returns the exit code it calls for. A program
+// that called exit isn't reported and gets the code it asked for. Other errors are not reported.
+func reportRunError(err error) (code int, ok bool) {
+	var exitError *interp.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.Code, true
+	}
+
+	var runtimeError *interp.RuntimeError
+	if errors.As(err, &runtimeError) {
+		reporter.Report(&diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     diag.RuntimeError,
+			Message:  runtimeError.Message,
+			Line:     runtimeError.Line,
+			Column:   runtimeError.Span.Column,
+			Length:   runtimeError.Span.Length,
+		})
+		return 70, true
+	}
+
+	var limitError *interp.LimitError
+	if errors.As(err, &limitError) {
+		reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.LimitExceeded, Message: limitError.Message, Line: limitError.Line})
+		return 75, true
+	}
+	return 0, false
+}
+
+// formatFiles prints the formatted files, or with write rewrites them, or with check lists the
+// ones that would change and exits 1 if there are any.
+func formatFiles(filenames []string, write bool, check bool) {
+	unformatted := false
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			reportError(diag.FileError, "Could not read file: %v", err)
+			os.Exit(1)
+		}
+		formatted, err := format.Source(context.Background(), src)
+		if err != nil {
+			reporter.File = filename
+			if !reporter.ReportError(err) {
+				reportError(diag.InvalidFile, "%v", err)
+			}
+			os.Exit(65)
+		}
+
+		switch {
+		case check:
+			if !bytes.Equal(src, formatted) {
+				fmt.Println(filename)
+				unformatted = true
+			}
+		case write:
+			if bytes.Equal(src, formatted) {
+				continue
+			}
+			if err := os.WriteFile(filename, formatted, 0644); err != nil {
+				reportError(diag.FileError, "Could not write file: %v", err)
+				os.Exit(1)
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	if unformatted {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+)
+
+func sortedLines(hits map[int]int) []int {
+	lines := make([]int, 0, len(hits))
+	for line := range hits {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// writeLcov writes hits in the lcov tracefile format understood by genhtml and most CI tools.
+func writeLcov(filename string, hits map[int]int, output string) error {
+	source, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("TN:\n")
+	builder.WriteString(fmt.Sprintf("SF:%s\n", source))
+	covered := 0
+	for _, line := range sortedLines(hits) {
+		builder.WriteString(fmt.Sprintf("DA:%d,%d\n", line, hits[line]))
+		if hits[line] > 0 {
+			covered++
+		}
+	}
+	builder.WriteString(fmt.Sprintf("LF:%d\nLH:%d\nend_of_record\n", len(hits), covered))
+	return os.WriteFile(output, []byte(builder.String()), 0644)
+}
+
+// reportCoverage prints a hit/miss summary of the lines with code to stderr if summary is set, and
+// writes an lcov report to output if it is not empty.
+func reportCoverage(filename string, hits map[int]int, summary bool, output string) {
+	if summary {
+		missed := make([]string, 0)
+		for _, line := range sortedLines(hits) {
+			if hits[line] == 0 {
+				missed = append(missed, fmt.Sprint(line))
+			}
+		}
+		covered := len(hits) - len(missed)
+		percent := 100.0
+		if len(hits) > 0 {
+			percent = float64(covered) * 100 / float64(len(hits))
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d/%d lines covered (%.1f%%)\n", filename, covered, len(hits), percent)
+		if len(missed) > 0 {
+			fmt.Fprintf(os.Stderr, "  missed lines: %s\n", strings.Join(missed, ", "))
+		}
+	}
+
+	if output != "" {
+		if err := writeLcov(filename, hits, output); err != nil {
+			reportError(diag.FileError, "Could not write coverage: %v", err)
+			os.Exit(1)
+		}
+	}
+}
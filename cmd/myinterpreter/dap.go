@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+)
+
+// The subset of the Debug Adapter Protocol needed to launch a program, stop at breakpoints, step
+// line by line and inspect the VM stack. Programs run on a single thread with a single frame.
+
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       any             `json:"body,omitempty"`
+}
+
+type dapArguments struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	Source      struct {
+		Path string `json:"path"`
+	} `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+	VariablesReference int `json:"variablesReference"`
+}
+
+const (
+	dapThreadID = 1
+	dapFrameID  = 1
+	dapStackRef = 1
+)
+
+var DebuggerDisconnectedError = errors.New("debugger disconnected")
+
+type dapServer struct {
+	writer io.Writer
+	// What the program's readLine reads, empty when the protocol itself runs over stdin
+	input io.Reader
+	// Guards seq and writes, which happen from both the request loop and the program
+	sendMutex sync.Mutex
+	seq       int
+
+	mutex       sync.Mutex
+	program     string
+	stopOnEntry bool
+	breakpoints map[int]bool
+	stepping    bool
+	paused      bool
+	// Where the paused program is, and its stack at that point
+	line  int
+	stack []interp.Value
+
+	resume chan bool
+	cancel context.CancelFunc
+}
+
+func (s *dapServer) send(message dapMessage) {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	s.seq++
+	message.Seq = s.seq
+	body, err := json.Marshal(message)
+	if err == nil {
+		err = writeFrame(s.writer, body)
+	}
+	if err != nil {
+		reportError(diag.FileError, "Could not send message: %v", err)
+	}
+}
+
+func (s *dapServer) respond(request *dapMessage, body any) {
+	success := true
+	s.send(dapMessage{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success, Body: body})
+}
+
+func (s *dapServer) fail(request *dapMessage, message string) {
+	success := false
+	s.send(dapMessage{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success, Message: message})
+}
+
+func (s *dapServer) event(event string, body any) {
+	s.send(dapMessage{Type: "event", Event: event, Body: body})
+}
+
+func (s *dapServer) output(category string, text string) {
+	s.event("output", map[string]string{"category": category, "output": text})
+}
+
+// programOutput forwards what the program writes, e.g. with printf, to the client as output
+// events, keeping it out of the protocol stream.
+type programOutput struct {
+	server *dapServer
+}
+
+func (o programOutput) Write(p []byte) (int, error) {
+	o.server.output("stdout", string(p))
+	return len(p), nil
+}
+
+// pauseAt is the VM's line hook. It blocks the program while the client inspects it.
+func (s *dapServer) pauseAt(vm *interp.VM, line int) error {
+	s.mutex.Lock()
+	reason := ""
+	switch {
+	case s.stopOnEntry:
+		reason = "entry"
+		s.stopOnEntry = false
+	case s.stepping:
+		reason = "step"
+	case s.breakpoints[line]:
+		reason = "breakpoint"
+	}
+	if reason == "" {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.line = line
+	s.stack = vm.Stack()
+	s.paused = true
+	s.mutex.Unlock()
+
+	s.event("stopped", map[string]any{"reason": reason, "threadId": dapThreadID, "allThreadsStopped": true})
+	if !<-s.resume {
+		return DebuggerDisconnectedError
+	}
+	return nil
+}
+
+// runProgram compiles and runs the launched program, reporting its output and exit through events.
+func (s *dapServer) runProgram(ctx context.Context) {
+	exitCode := 0
+	defer func() {
+		s.event("exited", map[string]int{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+
+	src, err := os.ReadFile(s.program)
+	if err != nil {
+		s.output("stderr", fmt.Sprintf("Error reading file: %v\n", err))
+		exitCode = 1
+		return
+	}
+	chunk, err := interp.New(interp.WithContext(ctx), interp.WithStderr(io.Discard)).Compile(string(src))
+	if err != nil {
+		s.output("stderr", err.Error()+"\n")
+		exitCode = 65
+		return
+	}
+
+	vm := interp.NewVM(interp.Limits{})
+	vm.SetInput(s.input)
+	vm.SetOutput(programOutput{s})
+	vm.OnLine(func(line int) error {
+		return s.pauseAt(vm, line)
+	})
+	value, err := vm.Run(ctx, chunk)
+	var runtimeError *interp.RuntimeError
+	var exitError *interp.ExitError
+	switch {
+	case errors.As(err, &exitError):
+		exitCode = exitError.Code
+	case errors.As(err, &runtimeError):
+		s.output("stderr", runtimeError.Error()+"\n")
+		exitCode = 70
+	case err != nil:
+		s.output("stderr", err.Error()+"\n")
+		exitCode = 1
+	default:
+		s.output("stdout", interp.FormatValue(value)+"\n")
+	}
+}
+
+// resumeProgram lets a paused program continue. Requests to resume a running program are
+// ignored.
+func (s *dapServer) resumeProgram(stepping bool, proceed bool) {
+	s.mutex.Lock()
+	s.stepping = stepping
+	paused := s.paused
+	s.paused = false
+	s.mutex.Unlock()
+	if paused {
+		s.resume <- proceed
+	}
+}
+
+func (s *dapServer) handle(request *dapMessage) (exit bool) {
+	var args dapArguments
+	if len(request.Arguments) > 0 {
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			s.fail(request, err.Error())
+			return false
+		}
+	}
+
+	switch request.Command {
+	case "initialize":
+		s.respond(request, map[string]bool{"supportsConfigurationDoneRequest": true})
+		s.event("initialized", nil)
+	case "launch":
+		s.mutex.Lock()
+		s.program = args.Program
+		s.stopOnEntry = args.StopOnEntry
+		s.mutex.Unlock()
+		s.respond(request, nil)
+	case "setBreakpoints":
+		breakpoints := make(map[int]bool)
+		verified := make([]map[string]any, 0, len(args.Breakpoints))
+		for _, breakpoint := range args.Breakpoints {
+			breakpoints[breakpoint.Line] = true
+			verified = append(verified, map[string]any{"verified": true, "line": breakpoint.Line})
+		}
+		s.mutex.Lock()
+		s.breakpoints = breakpoints
+		s.mutex.Unlock()
+		s.respond(request, map[string]any{"breakpoints": verified})
+	case "configurationDone":
+		s.respond(request, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		go s.runProgram(ctx)
+	case "threads":
+		s.respond(request, map[string]any{"threads": []map[string]any{{"id": dapThreadID, "name": "main"}}})
+	case "stackTrace":
+		s.mutex.Lock()
+		path, _ := filepath.Abs(s.program)
+		frame := map[string]any{
+			"id":     dapFrameID,
+			"name":   "script",
+			"line":   s.line,
+			"column": 1,
+			"source": map[string]string{"name": filepath.Base(s.program), "path": path},
+		}
+		s.mutex.Unlock()
+		s.respond(request, map[string]any{"stackFrames": []map[string]any{frame}, "totalFrames": 1})
+	case "scopes":
+		s.respond(request, map[string]any{"scopes": []map[string]any{{"name": "Stack", "variablesReference": dapStackRef, "expensive": false}}})
+	case "variables":
+		variables := make([]map[string]any, 0)
+		s.mutex.Lock()
+		if args.VariablesReference == dapStackRef {
+			for i, value := range s.stack {
+				variables = append(variables, map[string]any{"name": fmt.Sprintf("[%d]", i), "value": interp.FormatValue(value), "variablesReference": 0})
+			}
+		}
+		s.mutex.Unlock()
+		s.respond(request, map[string]any{"variables": variables})
+	case "continue":
+		s.respond(request, map[string]bool{"allThreadsContinued": true})
+		s.resumeProgram(false, true)
+	case "next", "stepIn", "stepOut":
+		// Without functions every step moves to the next line
+		s.respond(request, nil)
+		s.resumeProgram(true, true)
+	case "pause":
+		s.mutex.Lock()
+		s.stepping = true
+		s.mutex.Unlock()
+		s.respond(request, nil)
+	case "disconnect", "terminate":
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.resumeProgram(false, false)
+		s.respond(request, nil)
+		return request.Command == "disconnect"
+	default:
+		s.fail(request, "unsupported request: "+request.Command)
+	}
+	return false
+}
+
+func (s *dapServer) serve(reader *bufio.Reader) error {
+	for {
+		body, err := readFrame(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var request dapMessage
+		if err := json.Unmarshal(body, &request); err != nil {
+			return err
+		}
+		if request.Type != "request" {
+			continue
+		}
+		if s.handle(&request) {
+			return nil
+		}
+	}
+}
+
+// serveDAP runs a debug adapter over stdin and stdout, or over the first connection accepted on
+// listen if it is set.
+func serveDAP(listen string) {
+	var reader io.Reader = os.Stdin
+	var writer io.Writer = os.Stdout
+	var input io.Reader = strings.NewReader("")
+	if listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			reportError(diag.FileError, "Could not listen: %v", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			reportError(diag.FileError, "Could not accept connection: %v", err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+		reader, writer, input = conn, conn, os.Stdin
+	}
+
+	server := &dapServer{writer: writer, input: input, breakpoints: make(map[int]bool), resume: make(chan bool)}
+	if err := server.serve(bufio.NewReader(reader)); err != nil {
+		reportError(diag.FileError, "Could not read message: %v", err)
+		os.Exit(1)
+	}
+}
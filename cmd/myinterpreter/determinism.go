@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+)
+
+// determinismFlags replace the sources of nondeterminism a program can see: the clock, the random
+// seed and stdin.
+type determinismFlags struct {
+	clock     *string
+	seed      *string
+	stdinFile *string
+}
+
+// determinism is what the determinism flags asked for: the seconds since the Unix epoch the clock
+// is stopped at, the random seed and the contents of stdin. A nil field keeps the default.
+type determinism struct {
+	clock *float64
+	seed  *int64
+	stdin []byte
+}
+
+func addDeterminismFlags(flags *flag.FlagSet) *determinismFlags {
+	return &determinismFlags{
+		clock:     flags.String("fixed-clock", "", "make clock() always return this many seconds since the Unix epoch"),
+		seed:      flags.String("random-seed", "", "seed the random natives with this integer"),
+		stdinFile: flags.String("stdin-file", "", "make readLine() read this file instead of stdin"),
+	}
+}
+
+// parse validates the flags, exiting on invalid values. Flags left unset keep the defaults given.
+func (f *determinismFlags) parse(defaults determinism) determinism {
+	d := defaults
+	if *f.clock != "" {
+		seconds, err := strconv.ParseFloat(*f.clock, 64)
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			reportError(diag.InvalidArgument, "Invalid --fixed-clock value: %s", *f.clock)
+			os.Exit(1)
+		}
+		d.clock = &seconds
+	}
+	if *f.seed != "" {
+		seed, err := strconv.ParseInt(*f.seed, 10, 64)
+		if err != nil {
+			reportError(diag.InvalidArgument, "Invalid --random-seed value: %s", *f.seed)
+			os.Exit(1)
+		}
+		d.seed = &seed
+	}
+	if *f.stdinFile != "" {
+		stdin, err := os.ReadFile(*f.stdinFile)
+		if err != nil {
+			reportError(diag.FileError, "Could not read file: %v", err)
+			os.Exit(1)
+		}
+		d.stdin = stdin
+	}
+	return d
+}
+
+// fixedClock returns a clock stopped at the given seconds since the Unix epoch.
+func fixedClock(seconds float64) func() time.Time {
+	at := time.Unix(0, int64(seconds*float64(time.Second)))
+	return func() time.Time { return at }
+}
+
+func (d determinism) applyTo(vm *interp.VM) {
+	if d.clock != nil {
+		vm.SetClock(fixedClock(*d.clock))
+	}
+	if d.seed != nil {
+		vm.SeedRandom(*d.seed)
+	}
+	if d.stdin != nil {
+		vm.SetInput(bytes.NewReader(d.stdin))
+	}
+}
+
+func (d determinism) options() []interp.Option {
+	options := make([]interp.Option, 0, 3)
+	if d.clock != nil {
+		options = append(options, interp.WithClock(fixedClock(*d.clock)))
+	}
+	if d.seed != nil {
+		options = append(options, interp.WithRandomSeed(*d.seed))
+	}
+	if d.stdin != nil {
+		options = append(options, interp.WithStdin(bytes.NewReader(d.stdin)))
+	}
+	return options
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+)
+
+func dotLabel(expr ast.Expr) string {
+	switch node := expr.(type) {
+	case *ast.Unary:
+		return node.Operator.Lexeme
+	case *ast.Binary:
+		return node.Operator.Lexeme
+	case *ast.Logical:
+		return node.Operator.Lexeme
+	case *ast.StringLit:
+		return strconv.Quote(node.Value)
+	case *ast.Boolean, *ast.NumberLit, *ast.Nil, *ast.Variable:
+		return ast.Print(node)
+	case *ast.Grouping:
+		return "group"
+	case *ast.ListLit:
+		return "list"
+	case *ast.MapLit:
+		return "map"
+	case *ast.Index:
+		return "index"
+	case *ast.SetIndex:
+		return "set index"
+	case *ast.Slice:
+		return "slice"
+	case *ast.Interpolation:
+		return "concat"
+	case *ast.Call:
+		return "call"
+	default:
+		return nodeKind(expr)
+	}
+}
+
+// printDot renders expr as a Graphviz digraph with an edge from every node to each of its
+// children, in order.
+func printDot(expr ast.Expr) string {
+	builder := strings.Builder{}
+	builder.WriteString("digraph ast {\n")
+	builder.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+
+	next := 0
+	var visit func(expr ast.Expr) int
+	visit = func(expr ast.Expr) int {
+		id := next
+		next++
+		builder.WriteString(fmt.Sprintf("  n%d [label=%s];\n", id, strconv.Quote(dotLabel(expr))))
+		for _, child := range ast.Children(expr) {
+			childID := visit(child)
+			builder.WriteString(fmt.Sprintf("  n%d -> n%d;\n", id, childID))
+		}
+		return id
+	}
+	visit(expr)
+
+	builder.WriteString("}\n")
+	return builder.String()
+}
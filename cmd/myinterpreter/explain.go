@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// explainer evaluates a program by substitution, the way it is worked through on paper: each step
+// evaluates the leftmost expression whose operands are all values and puts its value in its
+// place. The VM does the evaluating, so every step means exactly what it does in a normal run.
+type explainer struct {
+	ctx    context.Context
+	vm     *interp.VM
+	parser *parser.Parser
+	// Values computed so far, standing in the tree as variables named after their source
+	values map[ast.Expr]interp.Value
+}
+
+// explain prints expr and then the rewritten expression after every step that changes how it
+// reads, and finally prints the value it comes to, as run does.
+func explain(ctx context.Context, vm *interp.VM, p *parser.Parser, expr ast.Expr) error {
+	e := &explainer{ctx: ctx, vm: vm, parser: p, values: make(map[ast.Expr]interp.Value)}
+	shown := format.Expr(expr)
+	fmt.Println(indentLines("   ", shown))
+	for !e.isValue(expr) {
+		var err error
+		if expr, err = e.step(expr); err != nil {
+			return err
+		}
+		if next := format.Expr(expr); next != shown {
+			shown = next
+			fmt.Println(indentLines("=> ", shown))
+		}
+	}
+
+	result, err := e.evaluate(expr)
+	if err != nil {
+		return err
+	}
+	fmt.Println(interp.FormatValue(e.values[result]))
+	return nil
+}
+
+// indentLines puts prefix before the first line and lines it up with the ones after.
+func indentLines(prefix string, text string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", len(prefix)))
+}
+
+func (e *explainer) isValue(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.Nil, *ast.Boolean, *ast.NumberLit, *ast.StringLit:
+		return true
+	}
+	_, ok := e.values[expr]
+	return ok
+}
+
+// step performs one evaluation step in expr and returns the rewritten expression.
+func (e *explainer) step(expr ast.Expr) (ast.Expr, error) {
+	switch node := expr.(type) {
+	case *ast.Grouping:
+		// Parentheses go as soon as what they hold is a value
+		if e.isValue(node.Value) {
+			return node.Value, nil
+		}
+		inner, err := e.step(node.Value)
+		if err != nil || e.isValue(inner) {
+			return inner, err
+		}
+		return ast.NewGrouping(inner), nil
+	case *ast.Logical:
+		// Once the left operand is known, the expression is either that value or the right operand
+		if e.isValue(node.Left) {
+			left, err := e.evaluate(node.Left)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(e.values[left]) == (node.Operator.Lexeme == "or") {
+				return left, nil
+			}
+			return node.Right, nil
+		}
+		left, err := e.step(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewLogical(left, node.Operator, node.Right), nil
+	}
+
+	children := append([]ast.Expr{}, ast.Children(expr)...)
+	for i, child := range children {
+		// A native is clearer called by its name than shown as <native fn>
+		if _, ok := child.(*ast.Variable); ok && i == 0 && isCall(expr) {
+			continue
+		}
+		if !e.isValue(child) {
+			reduced, err := e.step(child)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = reduced
+			return ast.WithChildren(expr, children), nil
+		}
+	}
+	return e.evaluate(expr)
+}
+
+// evaluate runs expr, whose operands are all values, on the VM and returns a node for its value.
+func (e *explainer) evaluate(expr ast.Expr) (ast.Expr, error) {
+	if _, ok := e.values[expr]; ok {
+		return expr, nil
+	}
+
+	// Computed values reach the VM as globals, since not all of them can be written as literals
+	children := append([]ast.Expr{}, ast.Children(expr)...)
+	for i, child := range children {
+		if value, ok := e.values[child]; ok {
+			name := fmt.Sprintf("$%d", i)
+			e.vm.SetGlobal(name, value)
+			children[i] = ast.NewVariable(scanner.Token{Type: scanner.Identifier, Lexeme: name})
+		}
+	}
+	if len(children) > 0 {
+		expr = ast.WithChildren(expr, children)
+	}
+
+	chunk, err := interp.NewCompiler(e.parser).Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	value, err := e.vm.Run(e.ctx, chunk)
+	if err != nil {
+		return nil, err
+	}
+	node := ast.NewVariable(scanner.Token{Type: scanner.Identifier, Lexeme: valueSource(value)})
+	e.values[node] = value
+	return node, nil
+}
+
+func isCall(expr ast.Expr) bool {
+	_, ok := expr.(*ast.Call)
+	return ok
+}
+
+func truthy(value interp.Value) bool {
+	switch v := value.(type) {
+	case interp.Nil:
+		return false
+	case interp.Bool:
+		return bool(v)
+	default:
+		return true
+	}
+}
+
+// valueSource writes value the way it would appear in source, quoting strings unlike FormatValue.
+// A list or map inside itself shows as [...] or {...}, as FormatValue prints it.
+func valueSource(value interp.Value) string {
+	return valueSourceIn(value, make(map[interp.Value]bool))
+}
+
+// valueSourceIn writes value inside the lists and maps marked in writing.
+func valueSourceIn(value interp.Value, writing map[interp.Value]bool) string {
+	switch v := value.(type) {
+	case interp.String:
+		return `"` + scanner.EscapeString(string(v)) + `"`
+	case *interp.ListValue:
+		if writing[v] {
+			return "[...]"
+		}
+		writing[v] = true
+		defer delete(writing, v)
+		elements := make([]string, 0, len(v.Elements))
+		for _, element := range v.Elements {
+			elements = append(elements, valueSourceIn(element, writing))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *interp.MapValue:
+		if writing[v] {
+			return "{...}"
+		}
+		writing[v] = true
+		defer delete(writing, v)
+		entries := make([]string, 0, v.Len())
+		for _, key := range v.Keys() {
+			entry, _ := v.Get(key)
+			entries = append(entries, valueSourceIn(key, writing)+": "+valueSourceIn(entry, writing))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return interp.FormatValue(value)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// A lint rule inspects a single node. Rules needing scopes (unused variables, shadowing, missing
+// returns) wait for declarations to exist in the language.
+var lintRules = []struct {
+	id    string
+	code  string
+	check func(expr ast.Expr) (message string, found bool)
+}{
+	{"constant-condition", diag.ConstantCondition, func(expr ast.Expr) (string, bool) {
+		logical, ok := expr.(*ast.Logical)
+		if !ok {
+			return "", false
+		}
+		truthy, ok := interp.ConstantTruthiness(logical.Left)
+		if !ok {
+			return "", false
+		}
+		value := "falsey"
+		if truthy {
+			value = "truthy"
+		}
+		return fmt.Sprintf("left operand of '%s' is always %s", logical.Operator.Lexeme, value), true
+	}},
+}
+
+// lintExpr returns a warning for each finding, with the rule's name after the message.
+func lintExpr(p *parser.Parser, expr ast.Expr) []*diag.Diagnostic {
+	findings := make([]*diag.Diagnostic, 0)
+	ast.Inspect(expr, func(expr ast.Expr) bool {
+		for _, rule := range lintRules {
+			if message, found := rule.check(expr); found {
+				findings = append(findings, &diag.Diagnostic{
+					Severity: diag.Warning,
+					Code:     rule.code,
+					Message:  fmt.Sprintf("%s [%s]", message, rule.id),
+					Line:     p.Line(expr),
+				})
+			}
+		}
+		return true
+	})
+	return findings
+}
+
+// systemDictionary is the word list spellchecking knows besides the user's, where there is one.
+const systemDictionary = "/usr/share/dict/words"
+
+// readDictionary adds the words of a word list, one per line, to words.
+func readDictionary(filename string, words map[string]bool) error {
+	list, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, word := range strings.Fields(string(list)) {
+		words[strings.ToLower(word)] = true
+	}
+	return nil
+}
+
+// A word is a run of letters, with apostrophes between them, at offset bytes into some text.
+type word struct {
+	offset int
+	text   string
+}
+
+func splitWords(text string) []word {
+	words := make([]word, 0)
+	start := -1
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r):
+			if start < 0 {
+				start = i
+			}
+		case r == '\'' && start >= 0:
+		default:
+			if start >= 0 {
+				words = append(words, word{start, strings.TrimRight(text[start:i], "'")})
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start, strings.TrimRight(text[start:], "'")})
+	}
+	return words
+}
+
+// spellcheck returns an info for each word in a comment or string that is neither in words nor
+// used as a name in the program. Words of one letter, and ones with capitals past the first, such
+// as acronyms and camelCase names, are never reported.
+func spellcheck(src []byte, tokens []scanner.Token, words map[string]bool) []*diag.Diagnostic {
+	known := maps.Clone(words)
+	for _, token := range tokens {
+		if token.Type == scanner.Identifier || token.Type == scanner.Keyword {
+			known[strings.ToLower(token.Lexeme)] = true
+		}
+	}
+
+	findings := make([]*diag.Diagnostic, 0)
+	// check reports the unknown words in text, which starts at the given line and column
+	check := func(text string, line int, column int) {
+		for _, w := range splitWords(text) {
+			rest := []rune(w.text)[1:]
+			if len(rest) == 0 || strings.ToLower(string(rest)) != string(rest) || known[strings.ToLower(w.text)] {
+				continue
+			}
+			before := text[:w.offset]
+			wordLine, wordColumn := line+strings.Count(before, "\n"), column+w.offset
+			if newline := strings.LastIndex(before, "\n"); newline >= 0 {
+				wordColumn = w.offset - newline
+			}
+			findings = append(findings, &diag.Diagnostic{
+				Severity: diag.Info,
+				Code:     diag.UnknownWord,
+				Message:  fmt.Sprintf("unknown word '%s' [spellcheck]", w.text),
+				Line:     wordLine,
+				Column:   wordColumn,
+				Length:   len(w.text),
+			})
+		}
+	}
+	for _, token := range tokens {
+		if (token.Type == scanner.String || token.Type == scanner.StringInterp) && token.Column > 0 {
+			check(token.Lexeme, token.Line, token.Column)
+		}
+	}
+	for _, comment := range format.Comments(src, tokens) {
+		check(comment.Text, comment.Line, comment.Column)
+	}
+	slices.SortStableFunc(findings, func(a, b *diag.Diagnostic) int {
+		return cmp.Or(a.Line-b.Line, a.Column-b.Column)
+	})
+	return findings
+}
+
+// lint reports findings through the reporter and exits 1 if there are warnings. With a dictionary,
+// words in comments and strings are spellchecked too, against it and the system dictionary.
+func lint(filename string, dictionary string) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		reportError(diag.FileError, "Could not read file: %v", err)
+		os.Exit(1)
+	}
+	tokens, err := tokenizeSource(context.Background(), filename, src)
+	exitOnTokenizeError(err)
+	p, expr := mustParse(context.Background(), tokens)
+
+	findings := lintExpr(p, expr)
+	for _, finding := range findings {
+		reporter.Report(finding)
+	}
+	if dictionary != "" {
+		words := make(map[string]bool)
+		if err := readDictionary(dictionary, words); err != nil {
+			reportError(diag.FileError, "Could not read dictionary: %v", err)
+			os.Exit(1)
+		}
+		// The system dictionary is optional, a missing one leaves only the user's
+		readDictionary(systemDictionary, words)
+		for _, finding := range spellcheck(src, tokens, words) {
+			reporter.Report(finding)
+		}
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+)
+
+var (
+	expectPattern             = regexp.MustCompile(`// expect: ?(.*)$`)
+	expectRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: ?(.*)$`)
+)
+
+// loxTest holds what a test file expects, read from its "// expect: ..." and
+// "// expect runtime error: ..." comments.
+type loxTest struct {
+	path         string
+	output       []string
+	runtimeError string
+}
+
+func readLoxTest(path string) (loxTest, []byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return loxTest{}, nil, err
+	}
+
+	test := loxTest{path: path, output: make([]string, 0)}
+	for _, line := range strings.Split(string(src), "\n") {
+		if match := expectRuntimeErrorPattern.FindStringSubmatch(line); match != nil {
+			test.runtimeError = strings.TrimRight(match[1], "\r")
+		} else if match := expectPattern.FindStringSubmatch(line); match != nil {
+			test.output = append(test.output, strings.TrimRight(match[1], "\r"))
+		}
+	}
+	return test, src, nil
+}
+
+// findLoxFiles expands directories into the .lox files below them, sorted by path.
+func findLoxFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && filepath.Ext(file) == ".lox" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func outputLines(output string) []string {
+	output = strings.TrimSuffix(output, "\n")
+	if output == "" {
+		return []string{}
+	}
+	return strings.Split(output, "\n")
+}
+
+// checkLoxTest runs a test and returns a description of every way it differs from what the test
+// expects.
+func checkLoxTest(test loxTest, src []byte, overrides determinism) []string {
+	var stdout, stderr bytes.Buffer
+	in := interp.New(append(overrides.options(), interp.WithStdout(&stdout), interp.WithStderr(&stderr))...)
+	err := in.Run(string(src))
+
+	failures := make([]string, 0)
+	var runtimeError *interp.RuntimeError
+	var exitError *interp.ExitError
+	switch {
+	case errors.As(err, &exitError):
+		if exitError.Code != 0 {
+			failures = append(failures, fmt.Sprintf("program exited with code %d", exitError.Code))
+		} else if test.runtimeError != "" {
+			failures = append(failures, fmt.Sprintf("expected runtime error %q, but the program exited", test.runtimeError))
+		}
+	case errors.As(err, &runtimeError):
+		if test.runtimeError == "" {
+			failures = append(failures, fmt.Sprintf("unexpected runtime error: %s", runtimeError.Message))
+		} else if runtimeError.Message != test.runtimeError {
+			failures = append(failures, fmt.Sprintf("expected runtime error %q, got %q", test.runtimeError, runtimeError.Message))
+		}
+	case err != nil:
+		failures = append(failures, fmt.Sprintf("unexpected error: %s", strings.TrimSpace(stderr.String()+err.Error())))
+	case test.runtimeError != "":
+		failures = append(failures, fmt.Sprintf("expected runtime error %q, but the program succeeded", test.runtimeError))
+	}
+
+	got := outputLines(stdout.String())
+	for i := 0; i < max(len(got), len(test.output)); i++ {
+		switch {
+		case i >= len(got):
+			failures = append(failures, fmt.Sprintf("missing expected output %q", test.output[i]))
+		case i >= len(test.output):
+			failures = append(failures, fmt.Sprintf("unexpected output %q", got[i]))
+		case got[i] != test.output[i]:
+			failures = append(failures, fmt.Sprintf("expected %q, got %q", test.output[i], got[i]))
+		}
+	}
+	return failures
+}
+
+// runLoxTests runs every .lox file under paths against its expectations and exits 1 if any fail.
+// With a replayDir, each failing test is saved there as a replay bundle.
+func runLoxTests(paths []string, replayDir string, overrides determinism) {
+	files, err := findLoxFiles(paths)
+	if err != nil {
+		reportError(diag.FileError, "Could not find tests: %v", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, file := range files {
+		test, src, err := readLoxTest(file)
+		if err != nil {
+			reportError(diag.FileError, "Could not read file: %v", err)
+			os.Exit(1)
+		}
+
+		failures := checkLoxTest(test, src, overrides)
+		if len(failures) == 0 {
+			fmt.Printf("PASS %s\n", file)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n", file)
+		for _, failure := range failures {
+			fmt.Printf("     %s\n", failure)
+		}
+		if replayDir != "" {
+			bundle, err := writeReplayBundle(replayDir, file, src, overrides, failures)
+			if err != nil {
+				reportError(diag.FileError, "Could not write replay bundle: %v", err)
+				os.Exit(1)
+			}
+			fmt.Printf("     replay with: run --replay-bundle=%s\n", bundle)
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", len(files)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// The subset of the Language Server Protocol needed for diagnostics, hover, signature help, folding,
+// document symbols and formatting.
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position lspPosition `json:"position"`
+}
+
+const (
+	lspSeverityError     = 1
+	lspMethodNotFound    = -32601
+	lspInvalidParams     = -32602
+	lspSyncFullDocuments = 1
+)
+
+type lspServer struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]string
+	// The standard library, by name, for signature help
+	natives map[string]*interp.NativeFunction
+}
+
+// maxFrameLength bounds message bodies, so a bad header can't make the server allocate without
+// limit.
+const maxFrameLength = 64 << 20
+
+// readFrame reads one message body framed by a Content-Length header, as used by both the
+// language server and debug adapter protocols.
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	if length < 0 || length > maxFrameLength {
+		return nil, fmt.Errorf("invalid Content-Length: %d", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeFrame(writer io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func readLSPMessage(reader *bufio.Reader) (*lspMessage, error) {
+	body, err := readFrame(reader)
+	if err != nil {
+		return nil, err
+	}
+	var message lspMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (s *lspServer) send(message lspMessage) error {
+	message.JSONRPC = "2.0"
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return writeFrame(s.writer, body)
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result any) error {
+	if result == nil {
+		// A null result must still be sent, omitempty would drop it
+		result = json.RawMessage("null")
+	}
+	return s.send(lspMessage{ID: id, Result: result})
+}
+
+// documentLines splits a document into the lines positions are counted in. Like columns, they
+// don't count a byte order mark.
+func documentLines(text string) []string {
+	return strings.Split(strings.TrimPrefix(text, "\ufeff"), "\n")
+}
+
+// lineRange converts a span of length bytes from the 1-based byte column on a 1-based line into
+// an LSP range, whose characters are UTF-16 code units. Spans without a column cover the whole
+// line, ones running past the end of the line count a unit per byte.
+func lineRange(lines []string, line int, column int, length int) lspRange {
+	line = max(line-1, 0)
+	if column == 0 {
+		return lspRange{lspPosition{line, 0}, lspPosition{line + 1, 0}}
+	}
+	text := ""
+	if line < len(lines) {
+		text = lines[line]
+	}
+	start := lspPosition{line, utf16Column(text, column-1)}
+	return lspRange{start, lspPosition{line, utf16Column(text, column-1+length)}}
+}
+
+// utf16Column counts the UTF-16 code units in the first offset bytes of line.
+func utf16Column(line string, offset int) int {
+	units := max(offset-len(line), 0)
+	for _, r := range line[:min(offset, len(line))] {
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return units
+}
+
+// tokenRange converts a token position into an LSP range. Tokens without a column cover the whole
+// line.
+func tokenRange(lines []string, token scanner.Token) lspRange {
+	return lineRange(lines, token.Line, token.Column, len(token.Lexeme))
+}
+
+func scanDocument(text string) ([]scanner.Token, error) {
+	return scanner.Scan(context.Background(), bufio.NewReader(strings.NewReader(text)))
+}
+
+func diagnose(text string) []lspDiagnostic {
+	tokens, err := scanDocument(text)
+	if err == nil {
+		_, err = parser.New(context.Background(), tokens).Parse()
+	}
+
+	lines := documentLines(text)
+	diagnostics := make([]lspDiagnostic, 0)
+	for _, d := range diag.Diagnostics(err) {
+		diagnostics = append(diagnostics, lspDiagnostic{diagnosticRange(lines, d), lspSeverityError, d.Code, "lox", d.Message})
+	}
+	return diagnostics
+}
+
+// diagnosticRange converts a diagnostic position into an LSP range. Diagnostics without a column
+// cover the whole line.
+func diagnosticRange(lines []string, d *diag.Diagnostic) lspRange {
+	return lineRange(lines, d.Line, d.Column, max(d.Length, 1))
+}
+
+var keywordDescriptions = map[string]string{
+	"true":  "Boolean literal.",
+	"false": "Boolean literal.",
+	"nil":   "The absence of a value.",
+	"and":   "Logical and: evaluates to the left operand if it is falsey, otherwise to the right one.",
+	"or":    "Logical or: evaluates to the left operand if it is truthy, otherwise to the right one.",
+}
+
+func hoverText(token scanner.Token) string {
+	switch token.Type {
+	case scanner.Number:
+		return "number " + token.Literal.String()
+	case scanner.String, scanner.StringInterp:
+		text, _ := token.Literal.Text()
+		return "string " + strconv.Quote(text)
+	case scanner.Identifier:
+		return "global " + token.Lexeme
+	case scanner.Keyword:
+		if description, ok := keywordDescriptions[token.Lexeme]; ok {
+			return "keyword " + token.Lexeme + "\n\n" + description
+		}
+		return "keyword " + token.Lexeme
+	default:
+		return ""
+	}
+}
+
+func (s *lspServer) hover(params lspDocumentParams) any {
+	// Tokens are still returned when part of the document fails to scan
+	text := s.documents[params.TextDocument.URI]
+	tokens, _ := scanDocument(text)
+	lines := documentLines(text)
+	for _, token := range tokens {
+		r := tokenRange(lines, token)
+		if token.Column == 0 || r.Start.Line != params.Position.Line {
+			continue
+		}
+		if params.Position.Character < r.Start.Character || params.Position.Character >= r.End.Character {
+			continue
+		}
+		text := hoverText(token)
+		if text == "" {
+			return nil
+		}
+		return map[string]any{
+			"contents": map[string]string{"kind": "plaintext", "value": text},
+			"range":    r,
+		}
+	}
+	return nil
+}
+
+// tokenBefore reports whether token starts before position.
+func tokenBefore(lines []string, token scanner.Token, position lspPosition) bool {
+	start := tokenRange(lines, token).Start
+	return start.Line < position.Line || (start.Line == position.Line && start.Character < position.Character)
+}
+
+// signatureHelp describes the native called by the innermost call whose parentheses enclose the
+// cursor, with the argument under the cursor active. Tokens are matched rather than the AST, so it
+// keeps working while the call is still being typed.
+func (s *lspServer) signatureHelp(params lspDocumentParams) any {
+	text := s.documents[params.TextDocument.URI]
+	tokens, _ := scanDocument(text)
+	lines := documentLines(text)
+	type openBracket struct {
+		index  int
+		commas int
+	}
+	open := make([]openBracket, 0)
+	for i, token := range tokens {
+		if token.Type == scanner.EOF || !tokenBefore(lines, token, params.Position) {
+			break
+		}
+		switch token.Type {
+		case scanner.LeftParen, scanner.LeftBracket, scanner.LeftBrace:
+			open = append(open, openBracket{index: i})
+		case scanner.RightParen, scanner.RightBracket, scanner.RightBrace:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case scanner.Comma:
+			if len(open) > 0 {
+				open[len(open)-1].commas++
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		paren := open[i]
+		if tokens[paren.index].Type != scanner.LeftParen || paren.index == 0 {
+			continue
+		}
+		callee := tokens[paren.index-1]
+		native, ok := s.natives[callee.Lexeme]
+		if callee.Type != scanner.Identifier || !ok {
+			continue
+		}
+		parameters := make([]map[string]string, 0, len(native.Params))
+		for _, param := range native.Params {
+			parameters = append(parameters, map[string]string{"label": param})
+		}
+		return map[string]any{
+			"signatures": []any{map[string]any{
+				"label":      native.Name + "(" + strings.Join(native.Params, ", ") + ")",
+				"parameters": parameters,
+			}},
+			"activeSignature": 0,
+			// Arguments past a variadic parameter all belong to it
+			"activeParameter": min(paren.commas, max(len(native.Params)-1, 0)),
+		}
+	}
+	return nil
+}
+
+type lspFoldingRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// foldingRanges lets editors collapse bracketed lists, maps, calls and groupings, and strings,
+// that span several lines. A bracketed region keeps its closing line visible.
+func (s *lspServer) foldingRanges(params lspDocumentParams) []lspFoldingRange {
+	tokens, _ := scanDocument(s.documents[params.TextDocument.URI])
+	ranges := make([]lspFoldingRange, 0)
+	open := make([]scanner.Token, 0)
+	for _, token := range tokens {
+		if token.Column == 0 {
+			continue
+		}
+		switch token.Type {
+		case scanner.LeftParen, scanner.LeftBracket, scanner.LeftBrace:
+			open = append(open, token)
+		case scanner.RightParen, scanner.RightBracket, scanner.RightBrace:
+			if len(open) == 0 {
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			if token.Line-1 > start.Line {
+				ranges = append(ranges, lspFoldingRange{start.Line - 1, token.Line - 2})
+			}
+		case scanner.String, scanner.StringInterp:
+			if lines := strings.Count(token.Lexeme, "\n"); lines > 0 {
+				ranges = append(ranges, lspFoldingRange{token.Line - 1, token.Line - 1 + lines})
+			}
+		}
+	}
+	// Editors expect ranges in document order, while brackets close innermost first
+	slices.SortStableFunc(ranges, func(a, b lspFoldingRange) int { return a.StartLine - b.StartLine })
+	return ranges
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// formatDocument formats the whole document, as one edit replacing all of it. A document that
+// doesn't parse, or is formatted already, needs no edits. The formatter has no notion of ranges,
+// so on-type formatting, which must only touch what was just typed, isn't offered.
+func (s *lspServer) formatDocument(params lspDocumentParams) []lspTextEdit {
+	text := s.documents[params.TextDocument.URI]
+	formatted, err := format.Source(context.Background(), []byte(text))
+	if err != nil || string(formatted) == text {
+		return []lspTextEdit{}
+	}
+	lines := documentLines(text)
+	last := lines[len(lines)-1]
+	end := lspPosition{len(lines) - 1, utf16Column(last, len(last))}
+	return []lspTextEdit{{lspRange{lspPosition{0, 0}, end}, string(formatted)}}
+}
+
+func (s *lspServer) publishDiagnostics(uri string) error {
+	params, err := json.Marshal(map[string]any{"uri": uri, "diagnostics": diagnose(s.documents[uri])})
+	if err != nil {
+		return err
+	}
+	return s.send(lspMessage{Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+func (s *lspServer) handle(message *lspMessage) (exit bool, err error) {
+	var params lspDocumentParams
+	if len(message.Params) > 0 {
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			if message.ID != nil {
+				return false, s.send(lspMessage{ID: message.ID, Error: &lspError{lspInvalidParams, "invalid params: " + err.Error()}})
+			}
+			return false, err
+		}
+	}
+
+	switch message.Method {
+	case "initialize":
+		return false, s.reply(message.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           lspSyncFullDocuments,
+				"hoverProvider":              true,
+				"documentSymbolProvider":     true,
+				"signatureHelpProvider":      map[string]any{"triggerCharacters": []string{"(", ","}},
+				"foldingRangeProvider":       true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "lox"},
+		})
+	case "textDocument/didOpen":
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		return false, s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didChange":
+		// Full sync: the last change holds the whole document
+		if len(params.ContentChanges) > 0 {
+			s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		}
+		return false, s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didClose":
+		delete(s.documents, params.TextDocument.URI)
+		return false, nil
+	case "textDocument/hover":
+		return false, s.reply(message.ID, s.hover(params))
+	case "textDocument/signatureHelp":
+		return false, s.reply(message.ID, s.signatureHelp(params))
+	case "textDocument/foldingRange":
+		return false, s.reply(message.ID, s.foldingRanges(params))
+	case "textDocument/formatting":
+		return false, s.reply(message.ID, s.formatDocument(params))
+	case "textDocument/documentSymbol":
+		// Programs are single expressions without declarations, so there is nothing to list yet
+		return false, s.reply(message.ID, []any{})
+	case "shutdown":
+		return false, s.reply(message.ID, nil)
+	case "exit":
+		return true, nil
+	default:
+		if message.ID != nil {
+			return false, s.send(lspMessage{ID: message.ID, Error: &lspError{lspMethodNotFound, "method not found: " + message.Method}})
+		}
+		// Unknown notifications are ignored
+		return false, nil
+	}
+}
+
+// serveLSP runs a language server over stdin and stdout until the client asks it to exit.
+func serveLSP() {
+	server := &lspServer{reader: bufio.NewReader(os.Stdin), writer: os.Stdout, documents: make(map[string]string), natives: make(map[string]*interp.NativeFunction)}
+	for _, native := range interp.NewVM(interp.Limits{}).Natives() {
+		server.natives[native.Name] = native
+	}
+	for {
+		message, err := readLSPMessage(server.reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			reportError(diag.FileError, "Could not read message: %v", err)
+			os.Exit(1)
+		}
+
+		exit, err := server.handle(message)
+		if err != nil {
+			reportError(diag.InvalidArgument, "Could not handle %s: %v", message.Method, err)
+		}
+		if exit {
+			return
+		}
+	}
+}
@@ -2,33 +2,124 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
 )
 
-func tokenizeFile(filename string) ([]Token, error) {
-	file, err := os.Open(filename)
+// reporter renders the diagnostics of every command. On a terminal they are colored, following
+// the NO_COLOR convention, and quote the source they point at. --no-color and --snippets=false
+// turn these off, --snippets turns quoting on anywhere.
+var reporter = func() *diag.Reporter {
+	r := diag.NewReporter(os.Stderr)
+	r.Color = diag.IsTerminal(os.Stderr) && os.Getenv("NO_COLOR") == ""
+	r.Snippets = diag.IsTerminal(os.Stderr)
+	return r
+}()
+
+// reportError reports a problem outside the program being run, such as a bad argument or a file
+// that can't be read, so that it follows --diagnostics like the program's own errors.
+func reportError(code string, format string, args ...any) {
+	reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// tokenizeFile scans a file, reporting scan errors.
+func tokenizeFile(ctx context.Context, filename string) ([]scanner.Token, error) {
+	src, err := os.ReadFile(filename)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		reportError(diag.FileError, "Could not read file: %v", err)
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	return tokenizeSource(ctx, filename, src)
+}
+
+// tokenizeSource scans the source of a file, reporting scan errors.
+func tokenizeSource(ctx context.Context, filename string, src []byte) ([]scanner.Token, error) {
+	reporter.File = filename
+	reporter.Source = src
+	tokens, err := scanner.Scan(ctx, bufio.NewReader(bytes.NewReader(src)))
+	reporter.ReportError(err)
+	return tokens, err
+}
 
-	reader := bufio.NewReader(file)
-	if data, _ := reader.Peek(1); len(data) > 0 {
-		tokens, err := scan(reader)
-		return tokens, err
-	} else {
-		return []Token{generateEOFToken(0)}, nil
+// mustTokenizeFile tokenizes a file for commands that consume tokens, exiting on scan errors.
+func mustTokenizeFile(ctx context.Context, filename string) []scanner.Token {
+	tokens, err := tokenizeFile(ctx, filename)
+	exitOnTokenizeError(err)
+	return tokens
+}
+
+// exitOnTokenizeError exits if scanning failed, with 65 for scan errors.
+func exitOnTokenizeError(err error) {
+	if err == nil {
+		return
+	}
+	exitOnTimeout(err)
+	if errors.Is(err, scanner.TokenScanError) {
+		os.Exit(65)
+	}
+	os.Exit(1)
+}
+
+// parseFlags parses params into flags, allowing flags after positional arguments, and returns the
+// positional arguments. Everything after a -- is positional.
+func parseFlags(flags *flag.FlagSet, params []string) []string {
+	var rest []string
+	if i := slices.Index(params, "--"); i >= 0 {
+		params, rest = params[:i], params[i+1:]
+	}
+	args := make([]string, 0)
+	for {
+		flags.Parse(params)
+		if flags.NArg() == 0 {
+			return append(args, rest...)
+		}
+		args = append(args, flags.Arg(0))
+		params = flags.Args()[1:]
 	}
 }
 
+// parseByteSize parses sizes like "4096", "64K", "64KB" or "1GB", with 1024-based units.
+func parseByteSize(size string) (int, error) {
+	units := []struct {
+		suffix     string
+		multiplier int
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}}
+
+	multiplier := 1
+	upper := strings.ToUpper(strings.TrimSpace(size))
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.Atoi(upper)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return value * multiplier, nil
+}
+
 func handleCommand(command string, params ...string) {
 	switch command {
 	case "tokenize":
-		tokens, err := tokenizeFile(params[0])
+		tokens, err := tokenizeFile(context.Background(), params[0])
 		if err != nil {
-			if errors.Is(err, TokenScanError) {
+			if errors.Is(err, scanner.TokenScanError) {
 				for _, token := range tokens {
 					fmt.Println(token.String())
 				}
@@ -41,23 +132,233 @@ func handleCommand(command string, params ...string) {
 			fmt.Println(token.String())
 		}
 	case "parse":
-		tokens, err := tokenizeFile(params[0])
+		flags := flag.NewFlagSet("parse", flag.ExitOnError)
+		format := flags.String("format", "sexpr", "output format: sexpr or dot")
+		args := parseFlags(flags, params)
+		if len(args) < 1 || (*format != "sexpr" && *format != "dot") {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh parse [--format=sexpr|dot] <filename>")
+			os.Exit(1)
+		}
+		tokens := mustTokenizeFile(context.Background(), args[0])
+		parse(tokens, *format)
+	case "query":
+		if len(params) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh query <filename> <selector>")
+			os.Exit(1)
+		}
+		tokens := mustTokenizeFile(context.Background(), params[0])
+		query(tokens, params[1])
+	case "run":
+		flags := flag.NewFlagSet("run", flag.ExitOnError)
+		backend := flags.String("backend", "vm", "execution backend, only vm is available")
+		verbose := flags.Bool("verbose", false, "report code removed by the compiler")
+		cpuProfile := flags.String("cpuprofile", "", "write a Go CPU profile of the interpreter to this file")
+		memProfile := flags.String("memprofile", "", "write a Go heap profile of the interpreter to this file")
+		maxSteps := flags.Int("max-steps", 0, "abort after executing this many VM instructions, 0 for no limit")
+		timeout := flags.Duration("timeout", 0, "abort the program after this long (e.g. 5s), 0 for no limit")
+		maxMemory := flags.String("max-memory", "0", "abort once the program holds this much data at once (e.g. 64MB), 0 for no limit")
+		coverage := flags.Bool("coverage", false, "print which source lines were executed to stderr")
+		coverageOut := flags.String("coverage-out", "", "write an lcov coverage report to this file")
+		explainSteps := flags.Bool("explain", false, "print each evaluation step, rewriting the program as it is evaluated")
+		determinismFlags := addDeterminismFlags(flags)
+		replayBundleFile := flags.String("replay-bundle", "", "rerun a failing test from a bundle written by test --replay-dir, instead of a file")
+		auditLog := flags.String("audit-log", "", "append a JSON line for each call of a native with side effects to this file")
+		divisionByZero := flags.String("division-by-zero", "infinity", "what dividing by zero does: infinity, as in the reference interpreter, or error")
+		args := parseFlags(flags, params)
+		if (len(args) < 1 && *replayBundleFile == "") || (*explainSteps && (*coverage || *coverageOut != "")) || *maxSteps < 0 || (*divisionByZero != "infinity" && *divisionByZero != "error") {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh run [--backend=vm] [--max-steps=N] [--max-memory=size] [--timeout=duration] [--division-by-zero=infinity|error] [--cpuprofile=file] [--memprofile=file] [--coverage] [--coverage-out=file.lcov] [--explain] [--audit-log=file] [--fixed-clock=seconds] [--random-seed=N] [--stdin-file=file] <filename | --replay-bundle=file> [--] [args...]")
+			os.Exit(1)
+		}
+		// A bundle stands in for the file and sets the overrides, which flags can still change
+		var bundle *replayBundle
+		defaults := determinism{}
+		if *replayBundleFile != "" {
+			bundle = readReplayBundle(*replayBundleFile)
+			defaults = bundle.determinism()
+			args = append([]string{bundle.File}, args...)
+		}
+		overrides := determinismFlags.parse(defaults)
+		memoryLimit, err := parseByteSize(*maxMemory)
 		if err != nil {
-			if errors.Is(err, TokenScanError) {
-				os.Exit(65)
+			reportError(diag.InvalidArgument, "%v", err)
+			os.Exit(1)
+		}
+		if *backend != "vm" {
+			reportError(diag.InvalidArgument, "Unknown backend: %s", *backend)
+			os.Exit(1)
+		}
+		filename := args[0]
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		stopProfiling := startProfiling(*cpuProfile, *memProfile)
+		var chunk *interp.Chunk
+		var tokens []scanner.Token
+		if bundle != nil {
+			tokens, err = tokenizeSource(ctx, filename, []byte(bundle.Source))
+			exitOnTokenizeError(err)
+			chunk = compileTokens(ctx, tokens, *verbose)
+		} else if interp.IsBytecodeFile(filename) {
+			if *explainSteps {
+				reportError(diag.InvalidArgument, "--explain needs the source, not bytecode")
+				os.Exit(1)
 			}
+			chunk, err = interp.ReadChunkFile(filename)
+			if err != nil {
+				reportError(diag.InvalidFile, "Could not load bytecode: %v", err)
+				os.Exit(1)
+			}
+		} else {
+			tokens = mustTokenizeFile(ctx, filename)
+			chunk = compileTokens(ctx, tokens, *verbose)
+		}
+		vm := interp.NewVM(interp.Limits{MaxSteps: *maxSteps, MaxMemory: memoryLimit})
+		if *coverage || *coverageOut != "" {
+			vm.EnableCoverage()
+		}
+		if *divisionByZero == "error" {
+			vm.EnableDivisionByZeroErrors()
+		}
+		vm.SetArgs(args[1:])
+		overrides.applyTo(vm)
+		closeAuditLog := func() {}
+		if *auditLog != "" {
+			closeAuditLog = startAuditLog(vm, filename, *auditLog)
+		}
+		if *explainSteps {
+			p, expr := mustParse(ctx, tokens)
+			err = explain(ctx, vm, p, expr)
+		} else {
+			err = run(ctx, vm, chunk)
+		}
+		closeAuditLog()
+		stopProfiling()
+		if *coverage || *coverageOut != "" {
+			reportCoverage(filename, vm.Coverage(chunk), *coverage, *coverageOut)
+		}
+		exitOnRunError(err)
+	case "compile":
+		flags := flag.NewFlagSet("compile", flag.ExitOnError)
+		verbose := flags.Bool("verbose", false, "report code removed by the compiler")
+		output := flags.String("output", "", "write a .loxc bytecode file instead of a disassembly")
+		args := parseFlags(flags, params)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh compile [--verbose] [--output=file.loxc] <filename>")
+			os.Exit(1)
+		}
+		tokens := mustTokenizeFile(context.Background(), args[0])
+		compile(tokens, args[0], *verbose, *output)
+	case "format":
+		flags := flag.NewFlagSet("format", flag.ExitOnError)
+		write := flags.Bool("write", false, "rewrite files in place instead of printing them")
+		check := flags.Bool("check", false, "list files that are not formatted and exit 1 if there are any")
+		args := parseFlags(flags, params)
+		if len(args) < 1 || (*write && *check) {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh format [--write | --check] <filename>...")
 			os.Exit(1)
 		}
-		parse(tokens)
+		formatFiles(args, *write, *check)
+	case "rewrite":
+		flags := flag.NewFlagSet("rewrite", flag.ExitOnError)
+		rule := flags.String("rule", "", "the rewrite to apply, as 'pattern -> replacement'; single lowercase letters match any expression")
+		write := flags.Bool("write", false, "rewrite files in place instead of printing them")
+		args := parseFlags(flags, params)
+		if len(args) < 1 || *rule == "" {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh rewrite --rule='pattern -> replacement' [--write] <filename>...")
+			os.Exit(1)
+		}
+		rewriteFiles(*rule, args, *write)
+	case "lint":
+		flags := flag.NewFlagSet("lint", flag.ExitOnError)
+		dictionary := flags.String("spellcheck", "", "also spellcheck comments and strings, knowing the words in this file, one per line, and the system dictionary")
+		args := parseFlags(flags, params)
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh lint [--spellcheck=dictionary] <filename>")
+			os.Exit(1)
+		}
+		lint(args[0], *dictionary)
+	case "test":
+		flags := flag.NewFlagSet("test", flag.ExitOnError)
+		determinismFlags := addDeterminismFlags(flags)
+		replayDir := flags.String("replay-dir", "", "write a replay bundle for each failing test into this directory")
+		args := parseFlags(flags, params)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh test [--fixed-clock=seconds] [--random-seed=N] [--stdin-file=file] [--replay-dir=dir] <path>...")
+			os.Exit(1)
+		}
+		// Tests compare output against expectations, so they run deterministically by default
+		runLoxTests(args, *replayDir, determinismFlags.parse(determinism{clock: new(float64), seed: new(int64), stdin: []byte{}}))
+	case "dap":
+		flags := flag.NewFlagSet("dap", flag.ExitOnError)
+		listen := flags.String("listen", "", "serve a single client on this TCP address (e.g. :4711) instead of stdio")
+		parseFlags(flags, params)
+		serveDAP(*listen)
+	case "lsp":
+		serveLSP()
+	case "repl":
+		repl(os.Stdin)
+	case "bench":
+		flags := flag.NewFlagSet("bench", flag.ExitOnError)
+		iterations := flags.Int("iterations", 10, "number of measured runs")
+		warmup := flags.Int("warmup", 2, "number of runs discarded before measuring")
+		args := parseFlags(flags, params)
+		if len(args) < 1 || *iterations < 1 || *warmup < 0 {
+			fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh bench [--iterations=N] [--warmup=N] <filename>")
+			os.Exit(1)
+		}
+		tokens := mustTokenizeFile(context.Background(), args[0])
+		bench(tokens, *iterations, *warmup)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
+		reportError(diag.UnknownCommand, "Unknown command: %s", command)
 		os.Exit(1)
 	}
 }
 
+// extractGlobalFlags applies the flags shared by every command, which may appear anywhere on the
+// command line before a --, and returns the remaining arguments.
+func extractGlobalFlags(args []string) []string {
+	remaining := make([]string, 0, len(args))
+	for i, arg := range args {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case arg == "--":
+			return append(remaining, args[i:]...)
+		case !strings.HasPrefix(arg, "-"):
+			remaining = append(remaining, arg)
+		case name == "diagnostics":
+			format, err := diag.ParseFormat(value)
+			if err != nil {
+				reportError(diag.InvalidArgument, "%v", err)
+				os.Exit(1)
+			}
+			reporter.Format = format
+		case name == "Werror":
+			reporter.WarningsAsErrors = true
+		case name == "no-color":
+			reporter.Color = false
+		case name == "snippets":
+			snippets, err := strconv.ParseBool(cmp.Or(value, "true"))
+			if err != nil {
+				reportError(diag.InvalidArgument, "Invalid --snippets value: %s", value)
+				os.Exit(1)
+			}
+			reporter.Snippets = snippets
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+	return remaining
+}
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <COMMAND> <filename>")
+	os.Args = extractGlobalFlags(os.Args)
+	// The REPL, language server and debug adapter talk over stdin and stdout instead of taking a
+	// file
+	if len(os.Args) < 3 && !(len(os.Args) == 2 && (os.Args[1] == "repl" || os.Args[1] == "lsp" || os.Args[1] == "dap")) {
+		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh [--diagnostics=text|json] [--no-color] [--snippets[=false]] [--Werror] <COMMAND> <filename>")
 		os.Exit(1)
 	}
 
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+)
+
+// startProfiling starts writing a CPU profile to cpuProfile if set, and returns a function that
+// stops it and writes a heap profile to memProfile if set.
+func startProfiling(cpuProfile string, memProfile string) func() {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		file, err := os.Create(cpuProfile)
+		if err != nil {
+			reportError(diag.FileError, "Could not create CPU profile: %v", err)
+			os.Exit(1)
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			reportError(diag.FileError, "Could not start CPU profile: %v", err)
+			os.Exit(1)
+		}
+		cpuFile = file
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+
+		if memProfile != "" {
+			file, err := os.Create(memProfile)
+			if err != nil {
+				reportError(diag.FileError, "Could not create memory profile: %v", err)
+				return
+			}
+			defer file.Close()
+			// Report live objects as of the end of the run
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(file); err != nil {
+				reportError(diag.FileError, "Could not write memory profile: %v", err)
+			}
+		}
+	}
+}
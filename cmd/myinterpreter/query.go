@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// A selector picks AST nodes by kind and attributes, CSS style. Steps separated by whitespace
+// match descendants, steps separated by '>' match direct children:
+//
+//	Unary[operator="-"] > NumberLit
+//	ListLit *[value]
+type selectorAttribute struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+type selectorStep struct {
+	kind       string
+	attributes []selectorAttribute
+	// child is set when the step must be a direct child of the previous one
+	child bool
+}
+
+var InvalidSelectorError = errors.New("invalid selector")
+
+func isSelectorNameChar(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+func readSelectorName(selector string, pos int) (string, int) {
+	start := pos
+	for pos < len(selector) && isSelectorNameChar(selector[pos]) {
+		pos++
+	}
+	return selector[start:pos], pos
+}
+
+func readSelectorAttribute(selector string, pos int) (selectorAttribute, int, error) {
+	attribute := selectorAttribute{}
+	attribute.name, pos = readSelectorName(selector, pos)
+	if attribute.name == "" {
+		return attribute, pos, fmt.Errorf("%w: expected attribute name at %d", InvalidSelectorError, pos)
+	}
+
+	if pos < len(selector) && selector[pos] == '=' {
+		pos++
+		if pos >= len(selector) || selector[pos] != '"' {
+			return attribute, pos, fmt.Errorf("%w: expected '\"' at %d", InvalidSelectorError, pos)
+		}
+		end := strings.IndexByte(selector[pos+1:], '"')
+		if end < 0 {
+			return attribute, pos, fmt.Errorf("%w: unterminated attribute value", InvalidSelectorError)
+		}
+		attribute.value = selector[pos+1 : pos+1+end]
+		attribute.hasValue = true
+		pos += end + 2
+	}
+
+	if pos >= len(selector) || selector[pos] != ']' {
+		return attribute, pos, fmt.Errorf("%w: expected ']' at %d", InvalidSelectorError, pos)
+	}
+	return attribute, pos + 1, nil
+}
+
+func parseSelector(selector string) ([]selectorStep, error) {
+	steps := make([]selectorStep, 0)
+	child := false
+	for pos := 0; pos < len(selector); {
+		switch {
+		case unicode.IsSpace(rune(selector[pos])):
+			pos++
+		case selector[pos] == '>':
+			if len(steps) == 0 || child {
+				return nil, fmt.Errorf("%w: unexpected '>' at %d", InvalidSelectorError, pos)
+			}
+			child = true
+			pos++
+		default:
+			step := selectorStep{child: child}
+			if selector[pos] == '*' {
+				step.kind = "*"
+				pos++
+			} else {
+				step.kind, pos = readSelectorName(selector, pos)
+				if step.kind == "" {
+					return nil, fmt.Errorf("%w: unexpected %q at %d", InvalidSelectorError, selector[pos], pos)
+				}
+			}
+
+			for pos < len(selector) && selector[pos] == '[' {
+				attribute, next, err := readSelectorAttribute(selector, pos+1)
+				if err != nil {
+					return nil, err
+				}
+				step.attributes = append(step.attributes, attribute)
+				pos = next
+			}
+
+			steps = append(steps, step)
+			child = false
+		}
+	}
+
+	if len(steps) == 0 || child {
+		return nil, fmt.Errorf("%w: expected a node kind", InvalidSelectorError)
+	}
+	return steps, nil
+}
+
+func nodeKind(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.Boolean:
+		return "Boolean"
+	case *ast.NumberLit:
+		return "NumberLit"
+	case *ast.StringLit:
+		return "StringLit"
+	case *ast.Nil:
+		return "Nil"
+	case *ast.Grouping:
+		return "Grouping"
+	case *ast.Unary:
+		return "Unary"
+	case *ast.Binary:
+		return "Binary"
+	case *ast.Logical:
+		return "Logical"
+	case *ast.ListLit:
+		return "ListLit"
+	case *ast.MapLit:
+		return "MapLit"
+	case *ast.Index:
+		return "Index"
+	case *ast.SetIndex:
+		return "SetIndex"
+	case *ast.Slice:
+		return "Slice"
+	case *ast.Interpolation:
+		return "Interpolation"
+	case *ast.Variable:
+		return "Variable"
+	case *ast.Call:
+		return "Call"
+	default:
+		return "Unknown"
+	}
+}
+
+func nodeAttributes(expr ast.Expr) map[string]string {
+	switch node := expr.(type) {
+	case *ast.Boolean, *ast.NumberLit, *ast.StringLit:
+		return map[string]string{"value": ast.Print(node)}
+	case *ast.Unary:
+		return map[string]string{"operator": node.Operator.Lexeme}
+	case *ast.Binary:
+		return map[string]string{"operator": node.Operator.Lexeme}
+	case *ast.Logical:
+		return map[string]string{"operator": node.Operator.Lexeme}
+	case *ast.Variable:
+		return map[string]string{"name": node.Name.Lexeme}
+	default:
+		return map[string]string{}
+	}
+}
+
+func (step selectorStep) matches(expr ast.Expr) bool {
+	if step.kind != "*" && step.kind != nodeKind(expr) {
+		return false
+	}
+
+	attributes := nodeAttributes(expr)
+	for _, attribute := range step.attributes {
+		value, ok := attributes[attribute.name]
+		if !ok || (attribute.hasValue && value != attribute.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPath reports whether the last node of path, whose ancestors are the rest of path, is
+// matched by steps[:last+1].
+func matchesPath(steps []selectorStep, last int, path []ast.Expr) bool {
+	if !steps[last].matches(path[len(path)-1]) {
+		return false
+	}
+	if last == 0 {
+		return true
+	}
+
+	ancestors := path[:len(path)-1]
+	if steps[last].child {
+		return len(ancestors) > 0 && matchesPath(steps, last-1, ancestors)
+	}
+	for i := len(ancestors); i > 0; i-- {
+		if matchesPath(steps, last-1, ancestors[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectNodes(root ast.Expr, steps []selectorStep) []ast.Expr {
+	result := make([]ast.Expr, 0)
+	var walk func(path []ast.Expr)
+	walk = func(path []ast.Expr) {
+		if matchesPath(steps, len(steps)-1, path) {
+			result = append(result, path[len(path)-1])
+		}
+		for _, child := range ast.Children(path[len(path)-1]) {
+			walk(append(path, child))
+		}
+	}
+	walk([]ast.Expr{root})
+	return result
+}
+
+func query(tokens []scanner.Token, selector string) {
+	steps, err := parseSelector(selector)
+	if err != nil {
+		reporter.Report(&diag.Diagnostic{Severity: diag.Error, Code: diag.InvalidSelector, Message: err.Error()})
+		os.Exit(1)
+	}
+
+	p, expr := mustParse(context.Background(), tokens)
+
+	for _, node := range selectNodes(expr, steps) {
+		fmt.Printf("[line %d] %s %s\n", p.Line(node), nodeKind(node), ast.Print(node))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/interp"
+)
+
+// repl evaluates one expression per line read from input and prints its value. Programs are
+// expressions, so every line is echoed; a trailing semicolon is accepted and ignored. Errors are
+// reported and the session goes on. readLine reads the lines following the one being evaluated.
+func repl(input *os.File) {
+	reader := bufio.NewReader(input)
+	// Errors come back from Eval and go through the reporter like everywhere else. Sharing the
+	// reader keeps readLine from buffering away lines the REPL should evaluate.
+	in := interp.New(interp.WithStderr(io.Discard), interp.WithStdin(reader))
+	prompt := diag.IsTerminal(input)
+	reporter.File = ""
+
+	for {
+		if prompt {
+			fmt.Print("> ")
+		}
+		line, err := reader.ReadString('\n')
+		if src := strings.TrimSuffix(strings.TrimSpace(line), ";"); src != "" {
+			evalLine(in, src)
+		}
+		if err != nil {
+			if prompt {
+				fmt.Println()
+			}
+			return
+		}
+	}
+}
+
+func evalLine(in *interp.Interpreter, src string) {
+	reporter.Source = []byte(src)
+	value, err := in.Eval(src)
+	if err == nil {
+		fmt.Println(interp.FormatValue(value))
+		return
+	}
+	if reporter.ReportError(err) {
+		return
+	}
+	code, ok := reportRunError(err)
+	if !ok {
+		reportError(diag.RuntimeError, "%v", err)
+	}
+	var exitError *interp.ExitError
+	if errors.As(err, &exitError) {
+		os.Exit(code)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+)
+
+// replayBundle captures a failing test together with the clock, random seed and stdin it ran with,
+// so run --replay-bundle can repeat the run exactly.
+type replayBundle struct {
+	File   string   `json:"file"`
+	Source string   `json:"source"`
+	Clock  *float64 `json:"clock"`
+	Seed   *int64   `json:"seed"`
+	// Base64 encoded; null keeps the real stdin, unlike an empty string
+	Stdin    []byte   `json:"stdin"`
+	Failures []string `json:"failures"`
+}
+
+func (b *replayBundle) determinism() determinism {
+	return determinism{clock: b.Clock, seed: b.Seed, stdin: b.Stdin}
+}
+
+// writeReplayBundle saves a bundle for a failing test into dir, named after the test's path so
+// tests with the same name in different directories don't collide.
+func writeReplayBundle(dir string, file string, src []byte, overrides determinism, failures []string) (string, error) {
+	bundle, err := json.MarshalIndent(replayBundle{
+		File:     file,
+		Source:   string(src),
+		Clock:    overrides.clock,
+		Seed:     overrides.seed,
+		Stdin:    overrides.stdin,
+		Failures: failures,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(strings.ReplaceAll(filepath.ToSlash(filepath.Clean(file)), "/", "_"), ".lox")
+	output := filepath.Join(dir, name+".replay.json")
+	return output, os.WriteFile(output, append(bundle, '\n'), 0644)
+}
+
+func readReplayBundle(path string) *replayBundle {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		reportError(diag.FileError, "Could not read file: %v", err)
+		os.Exit(1)
+	}
+	var bundle replayBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		reportError(diag.InvalidFile, "Invalid replay bundle %s: %v", path, err)
+		os.Exit(1)
+	}
+	return &bundle
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// A rewriteRule replaces every expression matching pattern with replacement. As in gofmt -r, a
+// name of a single lowercase letter is a wildcard: it matches any expression in the pattern, the
+// same one wherever it appears, and stands for that expression in the replacement.
+//
+//	len(s) == 0 -> s == ""
+type rewriteRule struct {
+	pattern     ast.Expr
+	replacement ast.Expr
+}
+
+func parseRuleExpr(text string) (ast.Expr, error) {
+	tokens, err := scanner.Scan(context.Background(), bufio.NewReader(strings.NewReader(text)))
+	if err != nil {
+		return nil, err
+	}
+	return parser.New(context.Background(), tokens).Parse()
+}
+
+func parseRewriteRule(rule string) (*rewriteRule, error) {
+	patternText, replacementText, ok := strings.Cut(rule, "->")
+	if !ok {
+		return nil, fmt.Errorf("rule must have the form 'pattern -> replacement'")
+	}
+	pattern, err := parseRuleExpr(patternText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	replacement, err := parseRuleExpr(replacementText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replacement: %w", err)
+	}
+
+	bound := make(map[string]bool)
+	ast.Inspect(pattern, func(expr ast.Expr) bool {
+		if name, ok := wildcard(expr); ok {
+			bound[name] = true
+		}
+		return true
+	})
+	var unbound string
+	ast.Inspect(replacement, func(expr ast.Expr) bool {
+		if name, ok := wildcard(expr); ok && !bound[name] && unbound == "" {
+			unbound = name
+		}
+		return true
+	})
+	if unbound != "" {
+		return nil, fmt.Errorf("replacement uses %s, which the pattern doesn't match", unbound)
+	}
+	return &rewriteRule{pattern, replacement}, nil
+}
+
+func wildcard(expr ast.Expr) (string, bool) {
+	variable, ok := expr.(*ast.Variable)
+	if !ok {
+		return "", false
+	}
+	name := variable.Name.Lexeme
+	return name, len(name) == 1 && name[0] >= 'a' && name[0] <= 'z'
+}
+
+// match reports whether expr has the shape of pattern, binding wildcards in bindings. With nil
+// bindings there are no wildcards and match compares two expressions.
+func match(pattern ast.Expr, expr ast.Expr, bindings map[string]ast.Expr) bool {
+	if name, ok := wildcard(pattern); ok && bindings != nil {
+		if bound, ok := bindings[name]; ok {
+			return match(bound, expr, nil)
+		}
+		bindings[name] = expr
+		return true
+	}
+
+	if nodeKind(pattern) != nodeKind(expr) || !maps.Equal(nodeAttributes(pattern), nodeAttributes(expr)) {
+		return false
+	}
+	patternChildren, children := ast.Children(pattern), ast.Children(expr)
+	if len(patternChildren) != len(children) {
+		return false
+	}
+	for i := range children {
+		if !match(patternChildren[i], children[i], bindings) {
+			return false
+		}
+	}
+	return true
+}
+
+// substitute fills the wildcards in template with the expressions they matched.
+func substitute(template ast.Expr, bindings map[string]ast.Expr) ast.Expr {
+	if name, ok := wildcard(template); ok {
+		return bindings[name]
+	}
+	children := ast.Children(template)
+	if len(children) == 0 {
+		return template
+	}
+	substituted := make([]ast.Expr, 0, len(children))
+	for _, child := range children {
+		substituted = append(substituted, substitute(child, bindings))
+	}
+	return withOperands(template, substituted)
+}
+
+// apply rewrites the subexpressions of expr before expr itself, so matches inside a match are
+// rewritten too, and counts the replacements. The text pieces of an interpolated string are part
+// of the string, not expressions written in the program, so they are never rewritten.
+func (rule *rewriteRule) apply(expr ast.Expr, count *int) ast.Expr {
+	if children := ast.Children(expr); len(children) > 0 {
+		_, interpolation := expr.(*ast.Interpolation)
+		rewritten := make([]ast.Expr, 0, len(children))
+		for i, child := range children {
+			if interpolation && i%2 == 0 {
+				rewritten = append(rewritten, child)
+				continue
+			}
+			rewritten = append(rewritten, rule.apply(child, count))
+		}
+		expr = withOperands(expr, rewritten)
+	}
+
+	bindings := make(map[string]ast.Expr)
+	if !match(rule.pattern, expr, bindings) {
+		return expr
+	}
+	*count++
+	return substitute(rule.replacement, bindings)
+}
+
+// precedence ranks expressions by how tightly they bind, following the parser's grammar.
+func precedence(expr ast.Expr) int {
+	switch node := expr.(type) {
+	case *ast.SetIndex:
+		return 0
+	case *ast.Logical:
+		if node.Operator.Lexeme == "or" {
+			return 1
+		}
+		return 2
+	case *ast.Binary:
+		switch node.Operator.Type {
+		case scanner.EqualEqual, scanner.BangEqual:
+			return 3
+		case scanner.Less, scanner.LessEqual, scanner.Greater, scanner.GreaterEqual:
+			return 4
+		case scanner.Plus, scanner.Minus:
+			return 5
+		default:
+			return 6
+		}
+	case *ast.Unary:
+		return 7
+	case *ast.Index, *ast.Slice, *ast.Call:
+		return 8
+	default:
+		return 9
+	}
+}
+
+// withOperands is ast.WithChildren, adding the parentheses an operand needs to keep its meaning
+// where it ends up: the formatter only prints the ones in the tree.
+func withOperands(expr ast.Expr, children []ast.Expr) ast.Expr {
+	// The lowest precedence each operand can have without parentheses, left to right
+	var minimums []int
+	switch node := expr.(type) {
+	case *ast.Binary, *ast.Logical:
+		// Operators are left associative, so an equal one on the right needs parentheses
+		minimums = []int{precedence(node), precedence(node) + 1}
+	case *ast.Unary:
+		minimums = []int{7}
+	case *ast.Index, *ast.Slice, *ast.Call, *ast.SetIndex:
+		minimums = []int{8}
+	}
+	for i, minimum := range minimums {
+		if precedence(children[i]) < minimum {
+			children[i] = ast.NewGrouping(children[i])
+		}
+	}
+	return ast.WithChildren(expr, children)
+}
+
+// rewriteFiles applies rule to each file, printing the results or, with write, saving the files
+// that change.
+func rewriteFiles(rule string, filenames []string, write bool) {
+	parsed, err := parseRewriteRule(rule)
+	if err != nil {
+		reportError(diag.InvalidArgument, "Invalid rule: %v", err)
+		os.Exit(1)
+	}
+
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			reportError(diag.FileError, "Could not read file: %v", err)
+			os.Exit(1)
+		}
+		count := 0
+		rewritten, err := format.Rewrite(context.Background(), src, func(expr ast.Expr) ast.Expr {
+			return parsed.apply(expr, &count)
+		})
+		if err != nil {
+			reporter.File = filename
+			if !reporter.ReportError(err) {
+				reportError(diag.InvalidFile, "%v", err)
+			}
+			os.Exit(65)
+		}
+
+		if !write {
+			os.Stdout.Write(rewritten)
+			continue
+		}
+		if count == 0 || bytes.Equal(src, rewritten) {
+			continue
+		}
+		if err := os.WriteFile(filename, rewritten, 0644); err != nil {
+			reportError(diag.FileError, "Could not write file: %v", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d replaced\n", filename, count)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/format"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		rule  string
+		src   string
+		want  string
+		count int
+	}{
+		{"len(s) == 0 -> s == \"\"", `len(x) == 0`, "x == \"\"\n", 1},
+		{"a * b -> b * a", "(1 + 2) * 3", "3 * (1 + 2)\n", 1},
+		{`"a" -> 1`, `"a${2}"`, "\"a${2}\"\n", 0},
+		{`"a" -> 1`, `"a${"a"}a"`, "\"a${1}a\"\n", 1},
+		{"x -> [x]", `"s${1}t"`, "[\"s${[1]}t\"]\n", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.rule+" on "+test.src, func(t *testing.T) {
+			rule, err := parseRewriteRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			got, err := format.Rewrite(context.Background(), []byte(test.src), func(expr ast.Expr) ast.Expr {
+				return rule.apply(expr, &count)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want || count != test.count {
+				t.Errorf("got %q with %d replaced, want %q with %d", got, count, test.want, test.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// Expr is an expression node. The node types below are the only implementations; walk them with a
+// Visitor or with Inspect.
+type Expr interface {
+	exprNode()
+}
+
+type Boolean struct {
+	Value bool
+}
+type NumberLit struct {
+	Value float64
+}
+type StringLit struct {
+	Value string
+}
+type Grouping struct {
+	Value Expr
+}
+type Unary struct {
+	Operator   scanner.Token
+	Expression Expr
+}
+type Binary struct {
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+type Logical struct {
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+type ListLit struct {
+	Elements []Expr
+}
+type MapEntry struct {
+	Key   Expr
+	Value Expr
+}
+type MapLit struct {
+	Entries []MapEntry
+}
+type Index struct {
+	Object  Expr
+	Bracket scanner.Token
+	Index   Expr
+}
+
+// SetIndex assigns to an element of a list or map, as in xs[i] = value.
+type SetIndex struct {
+	Object  Expr
+	Bracket scanner.Token
+	Index   Expr
+	Value   Expr
+}
+type Slice struct {
+	Object  Expr
+	Bracket scanner.Token
+	Start   Expr
+	End     Expr
+}
+type Interpolation struct {
+	Parts []Expr
+}
+type Variable struct {
+	Name scanner.Token
+}
+type Call struct {
+	Callee    Expr
+	Paren     scanner.Token
+	Arguments []Expr
+}
+
+// Nil keeps its keyword token. Besides locating it, this gives every node its own address: tooling
+// keys nodes by pointer, and pointers to zero-size values may all be equal.
+type Nil struct {
+	Keyword scanner.Token
+}
+
+func (*Boolean) exprNode()       {}
+func (*NumberLit) exprNode()     {}
+func (*StringLit) exprNode()     {}
+func (*Grouping) exprNode()      {}
+func (*Unary) exprNode()         {}
+func (*Binary) exprNode()        {}
+func (*Logical) exprNode()       {}
+func (*ListLit) exprNode()       {}
+func (*MapLit) exprNode()        {}
+func (*Index) exprNode()         {}
+func (*SetIndex) exprNode()      {}
+func (*Slice) exprNode()         {}
+func (*Interpolation) exprNode() {}
+func (*Variable) exprNode()      {}
+func (*Call) exprNode()          {}
+func (*Nil) exprNode()           {}
+
+func NewNil(keyword scanner.Token) Expr {
+	return &Nil{keyword}
+}
+
+func NewBoolean(value bool) Expr {
+	return &Boolean{value}
+}
+
+func NewNumberLit(value float64) Expr { return &NumberLit{value} }
+
+func NewStringLit(value string) Expr { return &StringLit{value} }
+
+func NewLiteral(token scanner.Token) (Expr, error) {
+	switch token.Type {
+	case scanner.Keyword:
+		switch token.Lexeme {
+		case "true":
+			return NewBoolean(true), nil
+		case "false":
+			return NewBoolean(false), nil
+		case "nil":
+			return NewNil(token), nil
+		default:
+			return nil, fmt.Errorf("unsupported keyword type: %s", token.Lexeme)
+		}
+	case scanner.Number:
+		value, ok := token.Literal.Number()
+		if !ok {
+			return nil, fmt.Errorf("invalid number literal: %s", token.Lexeme)
+		}
+		return NewNumberLit(value), nil
+	case scanner.String, scanner.StringInterp:
+		value, ok := token.Literal.Text()
+		if !ok {
+			return nil, fmt.Errorf("invalid string literal: %s", token.Lexeme)
+		}
+		return NewStringLit(value), nil
+	default:
+		return nil, fmt.Errorf("unsupported token type: %s", token.Lexeme)
+	}
+}
+
+func NewGrouping(expr Expr) Expr {
+	return &Grouping{expr}
+}
+
+func NewUnary(op scanner.Token, exp Expr) Expr {
+	return &Unary{op, exp}
+}
+
+func NewBinary(left Expr, op scanner.Token, right Expr) Expr {
+	return &Binary{left, op, right}
+}
+
+func NewLogical(left Expr, op scanner.Token, right Expr) Expr {
+	return &Logical{left, op, right}
+}
+
+func NewListLit(elements []Expr) Expr { return &ListLit{elements} }
+
+func NewMapLit(entries []MapEntry) Expr { return &MapLit{entries} }
+
+func NewIndex(object Expr, bracket scanner.Token, index Expr) Expr {
+	return &Index{object, bracket, index}
+}
+
+func NewSetIndex(object Expr, bracket scanner.Token, index Expr, value Expr) Expr {
+	return &SetIndex{object, bracket, index, value}
+}
+
+func NewSlice(object Expr, bracket scanner.Token, start Expr, end Expr) Expr {
+	return &Slice{object, bracket, start, end}
+}
+
+func NewInterpolation(parts []Expr) Expr { return &Interpolation{parts} }
+
+func NewVariable(name scanner.Token) Expr { return &Variable{name} }
+
+func NewCall(callee Expr, paren scanner.Token, arguments []Expr) Expr {
+	return &Call{callee, paren, arguments}
+}
@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// Print renders expr as an S-expression, as the parse command shows it.
+func Print(expr Expr) string {
+	return Accept[string](expr, printer{})
+}
+
+type printer struct{}
+
+func (p printer) list(name string, exprs []Expr) string {
+	builder := strings.Builder{}
+	builder.WriteString("(" + name)
+	for _, expr := range exprs {
+		builder.WriteString(" " + Print(expr))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (printer) VisitNil(*Nil) string { return "nil" }
+
+func (printer) VisitBoolean(node *Boolean) string { return strconv.FormatBool(node.Value) }
+
+func (printer) VisitNumberLit(node *NumberLit) string { return scanner.FormatNumber(node.Value) }
+
+func (printer) VisitStringLit(node *StringLit) string { return node.Value }
+
+func (printer) VisitGrouping(node *Grouping) string { return "(group " + Print(node.Value) + ")" }
+
+func (printer) VisitUnary(node *Unary) string {
+	return fmt.Sprintf("(%s %s)", node.Operator.Lexeme, Print(node.Expression))
+}
+
+func (printer) VisitBinary(node *Binary) string {
+	return fmt.Sprintf("(%s %s %s)", node.Operator.Lexeme, Print(node.Left), Print(node.Right))
+}
+
+func (printer) VisitLogical(node *Logical) string {
+	return fmt.Sprintf("(%s %s %s)", node.Operator.Lexeme, Print(node.Left), Print(node.Right))
+}
+
+func (p printer) VisitListLit(node *ListLit) string { return p.list("list", node.Elements) }
+
+func (printer) VisitMapLit(node *MapLit) string {
+	builder := strings.Builder{}
+	builder.WriteString("(map")
+	for _, entry := range node.Entries {
+		builder.WriteString(fmt.Sprintf(" (%s %s)", Print(entry.Key), Print(entry.Value)))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (printer) VisitIndex(node *Index) string {
+	return fmt.Sprintf("(index %s %s)", Print(node.Object), Print(node.Index))
+}
+
+func (printer) VisitSetIndex(node *SetIndex) string {
+	return fmt.Sprintf("(set-index %s %s %s)", Print(node.Object), Print(node.Index), Print(node.Value))
+}
+
+func (printer) VisitSlice(node *Slice) string {
+	return fmt.Sprintf("(slice %s %s %s)", Print(node.Object), Print(node.Start), Print(node.End))
+}
+
+func (p printer) VisitInterpolation(node *Interpolation) string { return p.list("concat", node.Parts) }
+
+func (printer) VisitVariable(node *Variable) string { return node.Name.Lexeme }
+
+func (p printer) VisitCall(node *Call) string {
+	return p.list("call "+Print(node.Callee), node.Arguments)
+}
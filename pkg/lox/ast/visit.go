@@ -0,0 +1,144 @@
+package ast
+
+import "fmt"
+
+// Visitor computes a result of type R for each kind of node. Passes that walk the tree implement
+// it instead of adding methods to the nodes.
+type Visitor[R any] interface {
+	VisitNil(node *Nil) R
+	VisitBoolean(node *Boolean) R
+	VisitNumberLit(node *NumberLit) R
+	VisitStringLit(node *StringLit) R
+	VisitGrouping(node *Grouping) R
+	VisitUnary(node *Unary) R
+	VisitBinary(node *Binary) R
+	VisitLogical(node *Logical) R
+	VisitListLit(node *ListLit) R
+	VisitMapLit(node *MapLit) R
+	VisitIndex(node *Index) R
+	VisitSetIndex(node *SetIndex) R
+	VisitSlice(node *Slice) R
+	VisitInterpolation(node *Interpolation) R
+	VisitVariable(node *Variable) R
+	VisitCall(node *Call) R
+}
+
+// Accept dispatches expr to the visitor method for its kind.
+func Accept[R any](expr Expr, v Visitor[R]) R {
+	switch node := expr.(type) {
+	case *Nil:
+		return v.VisitNil(node)
+	case *Boolean:
+		return v.VisitBoolean(node)
+	case *NumberLit:
+		return v.VisitNumberLit(node)
+	case *StringLit:
+		return v.VisitStringLit(node)
+	case *Grouping:
+		return v.VisitGrouping(node)
+	case *Unary:
+		return v.VisitUnary(node)
+	case *Binary:
+		return v.VisitBinary(node)
+	case *Logical:
+		return v.VisitLogical(node)
+	case *ListLit:
+		return v.VisitListLit(node)
+	case *MapLit:
+		return v.VisitMapLit(node)
+	case *Index:
+		return v.VisitIndex(node)
+	case *SetIndex:
+		return v.VisitSetIndex(node)
+	case *Slice:
+		return v.VisitSlice(node)
+	case *Interpolation:
+		return v.VisitInterpolation(node)
+	case *Variable:
+		return v.VisitVariable(node)
+	case *Call:
+		return v.VisitCall(node)
+	default:
+		panic(fmt.Sprintf("unknown expression type %T", expr))
+	}
+}
+
+// Children returns the direct subexpressions of expr in source order.
+func Children(expr Expr) []Expr {
+	switch node := expr.(type) {
+	case *Grouping:
+		return []Expr{node.Value}
+	case *Unary:
+		return []Expr{node.Expression}
+	case *Binary:
+		return []Expr{node.Left, node.Right}
+	case *Logical:
+		return []Expr{node.Left, node.Right}
+	case *ListLit:
+		return node.Elements
+	case *MapLit:
+		children := make([]Expr, 0, len(node.Entries)*2)
+		for _, entry := range node.Entries {
+			children = append(children, entry.Key, entry.Value)
+		}
+		return children
+	case *Index:
+		return []Expr{node.Object, node.Index}
+	case *SetIndex:
+		return []Expr{node.Object, node.Index, node.Value}
+	case *Slice:
+		return []Expr{node.Object, node.Start, node.End}
+	case *Interpolation:
+		return node.Parts
+	case *Call:
+		return append([]Expr{node.Callee}, node.Arguments...)
+	default:
+		return nil
+	}
+}
+
+// WithChildren returns a copy of expr with its direct subexpressions replaced by children, which
+// must match what Children returns in number and order. Nodes without children are returned as is.
+func WithChildren(expr Expr, children []Expr) Expr {
+	switch node := expr.(type) {
+	case *Grouping:
+		return &Grouping{children[0]}
+	case *Unary:
+		return &Unary{node.Operator, children[0]}
+	case *Binary:
+		return &Binary{children[0], node.Operator, children[1]}
+	case *Logical:
+		return &Logical{children[0], node.Operator, children[1]}
+	case *ListLit:
+		return &ListLit{children}
+	case *MapLit:
+		entries := make([]MapEntry, 0, len(node.Entries))
+		for i := range node.Entries {
+			entries = append(entries, MapEntry{children[2*i], children[2*i+1]})
+		}
+		return &MapLit{entries}
+	case *Index:
+		return &Index{children[0], node.Bracket, children[1]}
+	case *SetIndex:
+		return &SetIndex{children[0], node.Bracket, children[1], children[2]}
+	case *Slice:
+		return &Slice{children[0], node.Bracket, children[1], children[2]}
+	case *Interpolation:
+		return &Interpolation{children}
+	case *Call:
+		return &Call{children[0], node.Paren, children[1:]}
+	default:
+		return expr
+	}
+}
+
+// Inspect calls fn for expr and then, depth first, for each of its subexpressions as long as fn
+// returns true.
+func Inspect(expr Expr, fn func(Expr) bool) {
+	if !fn(expr) {
+		return
+	}
+	for _, child := range Children(expr) {
+		Inspect(child, fn)
+	}
+}
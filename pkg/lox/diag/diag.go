@@ -0,0 +1,288 @@
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	// Info is for findings worth a look that aren't problems, such as a word missing from the
+	// dictionary
+	Info
+)
+
+// String names the severity as text diagnostics print it. Errors keep jlox's capitalized
+// "Error", warnings and infos read like a compiler's "warning".
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	default:
+		return "Error"
+	}
+}
+
+// color is the ANSI escape highlighting the severity.
+func (s Severity) color() string {
+	switch s {
+	case Warning:
+		return ansiYellow
+	case Info:
+		return ansiCyan
+	default:
+		return ansiRed
+	}
+}
+
+// Diagnostic codes. Scan errors are E1xxx, parse and compile errors E2xxx, runtime errors E3xxx,
+// errors in command arguments E4xxx, errors reading and writing files E5xxx, warnings Wxxxx and
+// infos Ixxxx.
+const (
+	UnexpectedCharacter = "E1001"
+	UnterminatedString  = "E1002"
+	ExpectExpression    = "E2001"
+	ExpectToken         = "E2002"
+	CompileLimit        = "E2003"
+	InvalidAssignment   = "E2004"
+	RuntimeError        = "E3001"
+	LimitExceeded       = "E3002"
+	InvalidSelector     = "E4001"
+	InvalidArgument     = "E4002"
+	UnknownCommand      = "E4003"
+	FileError           = "E5001"
+	InvalidFile         = "E5002"
+	UnreachableCode     = "W0001"
+	ConstantCondition   = "W0002"
+	UnknownWord         = "I0001"
+)
+
+type Format int
+
+const (
+	Text Format = iota
+	JSON
+)
+
+// ParseFormat parses the name of a Format, "text" or "json".
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	default:
+		return Text, fmt.Errorf("unknown diagnostics format: %s", name)
+	}
+}
+
+// Diagnostic is a problem found in a program, located by a 1-based line and column. Column is 0
+// when only the line is known. Where names the offending token the way jlox does, as "at 'x'" or
+// "at end", for errors that have one.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	File     string
+	Line     int
+	Column   int
+	Length   int
+	Where    string
+}
+
+// label is the severity followed by Where, if there is one.
+func (d *Diagnostic) label() string {
+	if d.Where == "" {
+		return d.Severity.String()
+	}
+	return d.Severity.String() + " " + d.Where
+}
+
+func (d *Diagnostic) Error() string {
+	// Runtime errors keep the jlox layout, with the line after the message
+	if strings.HasPrefix(d.Code, "E3") {
+		if d.Line == 0 {
+			return d.Message
+		}
+		return fmt.Sprintf("%s\n[line %d]", d.Message, d.Line)
+	}
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.label(), d.Message)
+	}
+	return fmt.Sprintf("[line %d] %s: %s", d.Line, d.label(), d.Message)
+}
+
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Severity string `json:"severity"`
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column,omitempty"`
+		Length   int    `json:"length,omitempty"`
+		Where    string `json:"where,omitempty"`
+	}{strings.ToLower(d.Severity.String()), d.Code, d.Message, d.File, d.Line, d.Column, d.Length, d.Where})
+}
+
+// Diagnostics collects the diagnostics wrapped anywhere in err, in order.
+func Diagnostics(err error) []*Diagnostic {
+	diagnostics := make([]*Diagnostic, 0)
+	var collect func(err error)
+	collect = func(err error) {
+		var diagnostic *Diagnostic
+		switch e := err.(type) {
+		case nil:
+		case *Diagnostic:
+			diagnostics = append(diagnostics, e)
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				collect(inner)
+			}
+		case interface{ Unwrap() error }:
+			// Wrapping a joined error must not hide all but its first diagnostic
+			collect(e.Unwrap())
+		default:
+			if errors.As(err, &diagnostic) {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+	}
+	collect(err)
+	return diagnostics
+}
+
+// Reporter renders diagnostics, either as text for people or as one JSON object per line.
+type Reporter struct {
+	out io.Writer
+	// File is filled in for diagnostics that don't name one
+	File   string
+	Format Format
+	// Color highlights text diagnostics with ANSI escapes
+	Color bool
+	// Source is the contents of File. With Snippets set, text diagnostics quote the line they
+	// point at from it.
+	Source   []byte
+	Snippets bool
+	// WarningsAsErrors reports warnings as errors
+	WarningsAsErrors bool
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiCyan   = "\x1b[1;36m"
+	ansiUnder  = "\x1b[4m"
+)
+
+// IsTerminal reports whether file is attached to a terminal, where colored output makes sense.
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize renders d like Error does, with the location in bold and the severity in its color.
+func colorize(d *Diagnostic) string {
+	location := fmt.Sprintf("%s[line %d]%s", ansiBold, d.Line, ansiReset)
+	if strings.HasPrefix(d.Code, "E3") {
+		message := ansiRed + d.Message + ansiReset
+		if d.Line == 0 {
+			return message
+		}
+		return message + "\n" + location
+	}
+
+	color := d.Severity.color()
+	if d.Line == 0 {
+		return fmt.Sprintf("%s%s%s: %s", color, d.label(), ansiReset, d.Message)
+	}
+	return fmt.Sprintf("%s %s%s%s: %s", location, color, d.label(), ansiReset, d.Message)
+}
+
+// snippet quotes the source line d points at, with a caret under the start of the offending
+// lexeme and tildes under the rest of it. It is empty when the line isn't in source.
+func snippet(d *Diagnostic, source []byte, color bool) string {
+	lines := strings.Split(string(source), "\n")
+	if d.Line < 1 || d.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[d.Line-1], "\r")
+	if d.Line == 1 {
+		// Columns don't count a byte order mark
+		line = strings.TrimPrefix(line, "\ufeff")
+	}
+	gutter := fmt.Sprintf("%5d | ", d.Line)
+	blank := strings.Repeat(" ", len(gutter)-2) + "| "
+	if d.Column < 1 || d.Column > len(line)+1 {
+		return gutter + line
+	}
+
+	start := d.Column - 1
+	end := min(start+max(d.Length, 1), len(line))
+	// Tabs are kept in the padding so the caret lines up whatever the tab width
+	padding := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, line[:start])
+	marker := "^" + strings.Repeat("~", max(end-start-1, 0))
+	if color {
+		line = line[:start] + ansiUnder + line[start:end] + ansiReset + line[end:]
+		marker = d.Severity.color() + marker + ansiReset
+	}
+	return gutter + line + "\n" + blank + padding + marker
+}
+
+func NewReporter(out io.Writer) *Reporter {
+	return &Reporter{out: out}
+}
+
+func (r *Reporter) Report(d *Diagnostic) {
+	// The file and severity are filled in on a copy, the caller's diagnostic stays as it was
+	c := *d
+	d = &c
+	if d.File == "" {
+		d.File = r.File
+	}
+	if d.Severity == Warning && r.WarningsAsErrors {
+		d.Severity = Error
+	}
+	if r.Format == JSON {
+		line, err := json.Marshal(d)
+		if err == nil {
+			r.out.Write(append(line, '\n'))
+			return
+		}
+	}
+	text := d.Error()
+	if r.Color {
+		text = colorize(d)
+	}
+	if r.Snippets && d.File == r.File {
+		if quoted := snippet(d, r.Source, r.Color); quoted != "" {
+			text += "\n" + quoted
+		}
+	}
+	fmt.Fprintln(r.out, text)
+}
+
+// ReportError reports every diagnostic in err and tells whether there were any.
+func (r *Reporter) ReportError(err error) bool {
+	diagnostics := Diagnostics(err)
+	for _, d := range diagnostics {
+		r.Report(d)
+	}
+	return len(diagnostics) > 0
+}
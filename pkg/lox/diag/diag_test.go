@@ -0,0 +1,128 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{Code: UnexpectedCharacter, Message: "Unexpected character: @", Line: 3}, "[line 3] Error: Unexpected character: @"},
+		{Diagnostic{Code: ExpectExpression, Message: "Expect expression.", Line: 1, Where: "at end"}, "[line 1] Error at end: Expect expression."},
+		{Diagnostic{Code: RuntimeError, Message: "Operands must be numbers.", Line: 2}, "Operands must be numbers.\n[line 2]"},
+		{Diagnostic{Code: LimitExceeded, Message: "Step limit exceeded."}, "Step limit exceeded."},
+		{Diagnostic{Severity: Warning, Code: ConstantCondition, Message: "always truthy", Line: 4}, "[line 4] warning: always truthy"},
+		{Diagnostic{Severity: Info, Code: UnknownWord, Message: "unknown word", Line: 1}, "[line 1] info: unknown word"},
+		{Diagnostic{Code: UnknownCommand, Message: "Unknown command: x"}, "Error: Unknown command: x"},
+	}
+	for _, test := range tests {
+		if got := test.d.Error(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"text": Text, "json": JSON} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("%s: got %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("xml: got no error")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	first := &Diagnostic{Message: "first"}
+	second := &Diagnostic{Message: "second"}
+	third := &Diagnostic{Message: "third"}
+	err := fmt.Errorf("scanning: %w", errors.Join(first, errors.New("not a diagnostic"), fmt.Errorf("inner: %w", errors.Join(second, third))))
+	if got := Diagnostics(err); !reflect.DeepEqual(got, []*Diagnostic{first, second, third}) {
+		t.Errorf("got %v, want first, second and third", got)
+	}
+	if got := Diagnostics(nil); len(got) != 0 {
+		t.Errorf("nil: got %v, want none", got)
+	}
+	if got := Diagnostics(errors.New("plain")); len(got) != 0 {
+		t.Errorf("plain error: got %v, want none", got)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	source := []byte("1 +\n\tx @ y\n")
+	tests := []struct {
+		name  string
+		setup func(r *Reporter)
+		d     Diagnostic
+		want  string
+	}{
+		{"text", func(r *Reporter) {}, Diagnostic{Code: UnexpectedCharacter, Message: "Unexpected character: @", Line: 2, Column: 4, Length: 1},
+			"[line 2] Error: Unexpected character: @\n"},
+		{"json", func(r *Reporter) { r.Format = JSON }, Diagnostic{Code: UnexpectedCharacter, Message: "Unexpected character: @", Line: 2, Column: 4, Length: 1},
+			`{"severity":"error","code":"E1001","message":"Unexpected character: @","file":"main.lox","line":2,"column":4,"length":1}` + "\n"},
+		{"json without position", func(r *Reporter) { r.Format = JSON }, Diagnostic{Severity: Info, Code: UnknownWord, Message: "unknown word", File: "other.lox"},
+			`{"severity":"info","code":"I0001","message":"unknown word","file":"other.lox","line":0}` + "\n"},
+		{"warnings as errors", func(r *Reporter) { r.WarningsAsErrors = true }, Diagnostic{Severity: Warning, Code: ConstantCondition, Message: "always truthy", Line: 1},
+			"[line 1] Error: always truthy\n"},
+		{"infos stay infos", func(r *Reporter) { r.WarningsAsErrors = true }, Diagnostic{Severity: Info, Code: UnknownWord, Message: "unknown word", Line: 1},
+			"[line 1] info: unknown word\n"},
+		{"snippet", func(r *Reporter) { r.Snippets = true }, Diagnostic{Code: UnexpectedCharacter, Message: "Unexpected character: @", Line: 2, Column: 4, Length: 3},
+			"[line 2] Error: Unexpected character: @\n    2 | \tx @ y\n      | \t  ^~~\n"},
+		{"snippet past the line", func(r *Reporter) { r.Snippets = true }, Diagnostic{Code: ExpectExpression, Message: "Expect expression.", Line: 1, Column: 9},
+			"[line 1] Error: Expect expression.\n    1 | 1 +\n"},
+		{"snippet of another file", func(r *Reporter) { r.Snippets = true }, Diagnostic{Code: ExpectExpression, Message: "Expect expression.", File: "other.lox", Line: 1, Column: 1},
+			"[line 1] Error: Expect expression.\n"},
+		{"color", func(r *Reporter) { r.Color = true }, Diagnostic{Severity: Warning, Code: ConstantCondition, Message: "always truthy", Line: 1},
+			ansiBold + "[line 1]" + ansiReset + " " + ansiYellow + "warning" + ansiReset + ": always truthy\n"},
+		{"runtime color", func(r *Reporter) { r.Color = true }, Diagnostic{Code: RuntimeError, Message: "Boom.", Line: 1},
+			ansiRed + "Boom." + ansiReset + "\n" + ansiBold + "[line 1]" + ansiReset + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := NewReporter(&out)
+			r.File, r.Source = "main.lox", source
+			test.setup(r)
+			d := test.d
+			r.Report(&d)
+			if got := out.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReportKeepsDiagnostic(t *testing.T) {
+	r := NewReporter(io.Discard)
+	r.File, r.WarningsAsErrors = "main.lox", true
+	d := &Diagnostic{Severity: Warning, Code: ConstantCondition, Message: "always truthy", Line: 1}
+	want := *d
+	r.Report(d)
+	if *d != want {
+		t.Errorf("reporting changed the diagnostic to %+v, want %+v", *d, want)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	var out bytes.Buffer
+	r := NewReporter(&out)
+	err := errors.Join(&Diagnostic{Code: UnexpectedCharacter, Message: "a", Line: 1}, &Diagnostic{Code: UnterminatedString, Message: "b", Line: 2})
+	if !r.ReportError(err) {
+		t.Error("diagnostics: got false, want true")
+	}
+	if got := strings.Count(out.String(), "\n"); got != 2 {
+		t.Errorf("got %d lines, want 2: %q", got, out.String())
+	}
+	if r.ReportError(errors.New("plain")) {
+		t.Error("plain error: got true, want false")
+	}
+}
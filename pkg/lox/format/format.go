@@ -0,0 +1,229 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+const (
+	indent   = "  "
+	maxWidth = 80
+)
+
+// tokenEnd returns the line token ends on and its 0-based end offset in that line. A string
+// spanning lines ends on its last line.
+func tokenEnd(token scanner.Token) (int, int) {
+	newlines := strings.Count(token.Lexeme, "\n")
+	if newlines == 0 {
+		return token.Line, token.Column - 1 + len(token.Lexeme)
+	}
+	return token.Line + newlines, len(token.Lexeme) - strings.LastIndex(token.Lexeme, "\n") - 1
+}
+
+// A Comment is a line comment, from its "//" to the end of its line. Column is the 1-based byte
+// offset of the "//" within the line, not counting a byte order mark, as token columns don't.
+type Comment struct {
+	Line   int
+	Column int
+	Text   string
+}
+
+// Comments finds the line comments in src, which scanned to tokens. A line comment can only follow
+// the last token on its line, so anything after that token starting with "//" is one. Lines a
+// string runs on past are code to their end.
+func Comments(src []byte, tokens []scanner.Token) []Comment {
+	lineEnds := make(map[int]int)
+	for _, token := range tokens {
+		if token.Column == 0 {
+			continue
+		}
+		line, end := tokenEnd(token)
+		for spanned := token.Line; spanned < line; spanned++ {
+			lineEnds[spanned] = math.MaxInt
+		}
+		lineEnds[line] = max(lineEnds[line], end)
+	}
+
+	comments := make([]Comment, 0)
+	for i, line := range bytes.Split(bytes.TrimPrefix(src, []byte("\ufeff")), []byte("\n")) {
+		start := min(lineEnds[i+1], len(line))
+		rest := bytes.TrimSpace(line[start:])
+		if bytes.HasPrefix(rest, []byte("//")) {
+			column := start + bytes.Index(line[start:], []byte("//")) + 1
+			comments = append(comments, Comment{i + 1, column, string(rest)})
+		}
+	}
+	return comments
+}
+
+// Source formats a Lox program. Comments are kept: those before or inside the expression are
+// moved above it, one on the expression's last line stays at the end of it and later ones follow
+// it.
+func Source(ctx context.Context, src []byte) ([]byte, error) {
+	return Rewrite(ctx, src, func(expr ast.Expr) ast.Expr { return expr })
+}
+
+// Rewrite formats src like Source, printing what rewrite returns for its expression instead of
+// the expression itself. Comments stay where Source would put them.
+func Rewrite(ctx context.Context, src []byte, rewrite func(ast.Expr) ast.Expr) ([]byte, error) {
+	// Formatted output never starts with a byte order mark
+	src = bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))
+	tokens, err := scanner.Scan(ctx, bufio.NewReader(bytes.NewReader(src)))
+	if err != nil {
+		return nil, err
+	}
+	comments := Comments(src, tokens)
+
+	out := bytes.Buffer{}
+	if len(tokens) == 0 || tokens[0].Type == scanner.EOF {
+		for _, c := range comments {
+			out.WriteString(c.Text + "\n")
+		}
+		return out.Bytes(), nil
+	}
+
+	expr, err := parser.New(ctx, tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	expr = rewrite(expr)
+	lastLine, _ := tokenEnd(tokens[len(tokens)-2])
+
+	for _, c := range comments {
+		if c.Line < lastLine {
+			out.WriteString(c.Text + "\n")
+		}
+	}
+	out.WriteString(printExpr(expr, 0))
+	for _, c := range comments {
+		if c.Line == lastLine {
+			out.WriteString(" " + c.Text)
+		}
+	}
+	out.WriteString("\n")
+	for _, c := range comments {
+		if c.Line > lastLine {
+			out.WriteString(c.Text + "\n")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// Expr prints a single expression as Lox source, laid out the way Source lays out a program.
+func Expr(expr ast.Expr) string {
+	return printExpr(expr, 0)
+}
+
+// printSequence prints elements between open and close on one line, or one per line when that
+// gets too wide or an element already spans several lines.
+func printSequence(open string, elements []string, close string, depth int) string {
+	flat := open + strings.Join(elements, ", ") + close
+	if len(elements) == 0 || (len(strings.Repeat(indent, depth))+len(flat) <= maxWidth && !strings.Contains(flat, "\n")) {
+		return flat
+	}
+
+	prefix := strings.Repeat(indent, depth+1)
+	return open + "\n" + prefix + strings.Join(elements, ",\n"+prefix) + "\n" + strings.Repeat(indent, depth) + close
+}
+
+func printAll(exprs []ast.Expr, depth int) []string {
+	printed := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		printed = append(printed, printExpr(expr, depth+1))
+	}
+	return printed
+}
+
+// printExpr prints expr as Lox source. Parentheses come only from groupings, which the parser
+// keeps, so operator precedence round-trips without adding any.
+func printExpr(expr ast.Expr, depth int) string {
+	return ast.Accept[string](expr, sourcePrinter{depth})
+}
+
+// sourcePrinter prints nodes nested depth levels deep in multi-line sequences.
+type sourcePrinter struct {
+	depth int
+}
+
+func (p sourcePrinter) VisitNil(node *ast.Nil) string { return ast.Print(node) }
+
+func (p sourcePrinter) VisitBoolean(node *ast.Boolean) string { return ast.Print(node) }
+
+func (p sourcePrinter) VisitNumberLit(node *ast.NumberLit) string {
+	return strconv.FormatFloat(node.Value, 'f', -1, 64)
+}
+
+func (p sourcePrinter) VisitStringLit(node *ast.StringLit) string {
+	return `"` + scanner.EscapeString(node.Value) + `"`
+}
+
+func (p sourcePrinter) VisitVariable(node *ast.Variable) string { return node.Name.Lexeme }
+
+func (p sourcePrinter) VisitGrouping(node *ast.Grouping) string {
+	return "(" + printExpr(node.Value, p.depth) + ")"
+}
+
+func (p sourcePrinter) VisitUnary(node *ast.Unary) string {
+	return node.Operator.Lexeme + printExpr(node.Expression, p.depth)
+}
+
+func (p sourcePrinter) VisitBinary(node *ast.Binary) string {
+	return printExpr(node.Left, p.depth) + " " + node.Operator.Lexeme + " " + printExpr(node.Right, p.depth)
+}
+
+func (p sourcePrinter) VisitLogical(node *ast.Logical) string {
+	return printExpr(node.Left, p.depth) + " " + node.Operator.Lexeme + " " + printExpr(node.Right, p.depth)
+}
+
+func (p sourcePrinter) VisitListLit(node *ast.ListLit) string {
+	return printSequence("[", printAll(node.Elements, p.depth), "]", p.depth)
+}
+
+func (p sourcePrinter) VisitMapLit(node *ast.MapLit) string {
+	entries := make([]string, 0, len(node.Entries))
+	for _, entry := range node.Entries {
+		entries = append(entries, printExpr(entry.Key, p.depth+1)+": "+printExpr(entry.Value, p.depth+1))
+	}
+	return printSequence("{", entries, "}", p.depth)
+}
+
+func (p sourcePrinter) VisitIndex(node *ast.Index) string {
+	return printExpr(node.Object, p.depth) + "[" + printExpr(node.Index, p.depth) + "]"
+}
+
+func (p sourcePrinter) VisitSetIndex(node *ast.SetIndex) string {
+	return printExpr(node.Object, p.depth) + "[" + printExpr(node.Index, p.depth) + "] = " + printExpr(node.Value, p.depth)
+}
+
+func (p sourcePrinter) VisitSlice(node *ast.Slice) string {
+	return printExpr(node.Object, p.depth) + "[" + printExpr(node.Start, p.depth) + ":" + printExpr(node.End, p.depth) + "]"
+}
+
+func (p sourcePrinter) VisitCall(node *ast.Call) string {
+	return printSequence(printExpr(node.Callee, p.depth)+"(", printAll(node.Arguments, p.depth), ")", p.depth)
+}
+
+// VisitInterpolation prints the parts, which alternate between string pieces and embedded
+// expressions, starting and ending with a piece. A piece a rewrite replaced with some other
+// expression is embedded like the expressions are.
+func (p sourcePrinter) VisitInterpolation(node *ast.Interpolation) string {
+	builder := strings.Builder{}
+	builder.WriteString(`"`)
+	for i, part := range node.Parts {
+		if piece, ok := part.(*ast.StringLit); ok && i%2 == 0 {
+			builder.WriteString(scanner.EscapeString(piece.Value))
+		} else {
+			builder.WriteString("${" + printExpr(part, p.depth) + "}")
+		}
+	}
+	builder.WriteString(`"`)
+	return builder.String()
+}
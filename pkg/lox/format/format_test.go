@@ -0,0 +1,90 @@
+package format
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+func TestSourceRoundTrip(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1+2", "1 + 2\n"},
+		{"// lead\n(1+2)*-3 >= 4 // trailing\n// after\n", "// lead\n(1 + 2) * -3 >= 4 // trailing\n// after\n"},
+		{"\"first\n// inside string\nlast\"\n", "\"first\n// inside string\nlast\"\n"},
+		{"\"a\n// b\" + // c\n\"d\"\n", "// c\n\"a\n// b\" + \"d\"\n"},
+		{"\"x${1 + // embedded\n2}y\"", "// embedded\n\"x${1 + 2}y\"\n"},
+		{"\xef\xbb\xbf[1,\n2]", "[1, 2]\n"},
+		{"// only a comment\n", "// only a comment\n"},
+		{`"cost: $${1}"`, "\"cost: $${1}\"\n"},
+		{`"$${a}${b}"`, "\"$${a}${b}\"\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			formatted, err := Source(context.Background(), []byte(test.src))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(formatted) != test.want {
+				t.Fatalf("got %q, want %q", formatted, test.want)
+			}
+
+			// Formatting is idempotent
+			again, err := Source(context.Background(), formatted)
+			if err != nil {
+				t.Fatalf("unexpected error formatting again: %v", err)
+			}
+			if string(again) != string(formatted) {
+				t.Errorf("second run gave %q, want %q", again, formatted)
+			}
+		})
+	}
+}
+
+func TestRewriteKeepsComments(t *testing.T) {
+	src := "// lead\n1 + 2 // trailing\n"
+	rewritten, err := Rewrite(context.Background(), []byte(src), func(expr ast.Expr) ast.Expr {
+		return ast.Children(expr)[1]
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "// lead\n2 // trailing\n"; string(rewritten) != want {
+		t.Errorf("got %q, want %q", rewritten, want)
+	}
+}
+
+func TestRewriteInterpolationPiece(t *testing.T) {
+	// A text piece replaced with another expression is printed embedded
+	rewritten, err := Rewrite(context.Background(), []byte(`"a${2}b"`), func(expr ast.Expr) ast.Expr {
+		interpolation := expr.(*ast.Interpolation)
+		parts := append([]ast.Expr{}, interpolation.Parts...)
+		parts[0] = ast.NewNumberLit(1)
+		return ast.NewInterpolation(parts)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "\"${1}${2}b\"\n"; string(rewritten) != want {
+		t.Errorf("got %q, want %q", rewritten, want)
+	}
+}
+
+func TestComments(t *testing.T) {
+	src := "\ufeff1 // one\n\"a // b\n\" + // two\n  // three\n"
+	tokens, err := scanner.Scan(context.Background(), bufio.NewReader(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Comment{{1, 3, "// one"}, {3, 5, "// two"}, {4, 3, "// three"}}
+	if got := Comments([]byte(src), tokens); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+type OpCode byte
+
+const (
+	OpConstant OpCode = iota
+	OpNil
+	OpTrue
+	OpFalse
+	OpZero
+	OpOne
+	OpPop
+	OpEqual
+	OpGreater
+	OpLess
+	OpGreaterEqual
+	OpLessEqual
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpNegate
+	OpNot
+	OpJump
+	OpJumpIfFalse
+	OpList
+	OpMap
+	OpIndex
+	OpSlice
+	OpConcat
+	OpGetGlobal
+	OpCall
+	OpReturn
+	// Later opcodes come last, so bytecode compiled before them keeps its meaning
+	OpSetIndex
+)
+
+var opCodeNames = map[OpCode]string{
+	OpConstant:     "OP_CONSTANT",
+	OpNil:          "OP_NIL",
+	OpTrue:         "OP_TRUE",
+	OpFalse:        "OP_FALSE",
+	OpZero:         "OP_ZERO",
+	OpOne:          "OP_ONE",
+	OpPop:          "OP_POP",
+	OpEqual:        "OP_EQUAL",
+	OpGreater:      "OP_GREATER",
+	OpLess:         "OP_LESS",
+	OpGreaterEqual: "OP_GREATER_EQUAL",
+	OpLessEqual:    "OP_LESS_EQUAL",
+	OpAdd:          "OP_ADD",
+	OpSubtract:     "OP_SUBTRACT",
+	OpMultiply:     "OP_MULTIPLY",
+	OpDivide:       "OP_DIVIDE",
+	OpNegate:       "OP_NEGATE",
+	OpNot:          "OP_NOT",
+	OpJump:         "OP_JUMP",
+	OpJumpIfFalse:  "OP_JUMP_IF_FALSE",
+	OpList:         "OP_LIST",
+	OpMap:          "OP_MAP",
+	OpIndex:        "OP_INDEX",
+	OpSlice:        "OP_SLICE",
+	OpConcat:       "OP_CONCAT",
+	OpGetGlobal:    "OP_GET_GLOBAL",
+	OpCall:         "OP_CALL",
+	OpReturn:       "OP_RETURN",
+	OpSetIndex:     "OP_SET_INDEX",
+}
+
+// Number of operand bytes following each opcode. Operands are big-endian uint16.
+var opCodeOperands = map[OpCode]int{
+	OpConstant:    2,
+	OpList:        2,
+	OpMap:         2,
+	OpConcat:      2,
+	OpGetGlobal:   2,
+	OpCall:        2,
+	OpJump:        2,
+	OpJumpIfFalse: 2,
+}
+
+const maxOperand = 1<<16 - 1
+
+// Span locates the token an instruction came from within its line. Column is 1-based and 0 when
+// unknown.
+type Span struct {
+	Column int
+	Length int
+}
+
+// Chunk is a sequence of bytecode instructions with the constants they refer to. Lines holds the
+// source line of every byte in Code and Spans its columns, when known.
+type Chunk struct {
+	Code      []byte
+	Lines     []int
+	Spans     []Span
+	Constants []Value
+	// Index of each constant already in the pool, keyed by constantKey
+	constantIndexes map[any]int
+}
+
+func (c *Chunk) write(b byte, line int, span Span) {
+	c.Code = append(c.Code, b)
+	c.Lines = append(c.Lines, line)
+	c.Spans = append(c.Spans, span)
+}
+
+func (c *Chunk) writeOp(op OpCode, line int, span Span) {
+	c.write(byte(op), line, span)
+}
+
+func (c *Chunk) writeOperand(operand int, line int, span Span) {
+	c.write(byte(operand>>8), line, span)
+	c.write(byte(operand), line, span)
+}
+
+// spanAt returns the span of the byte at offset, which is unknown for chunks loaded from bytecode
+// files.
+func (c *Chunk) spanAt(offset int) Span {
+	if offset < len(c.Spans) {
+		return c.Spans[offset]
+	}
+	return Span{}
+}
+
+func (c *Chunk) readOperand(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+// constantKey identifies a constant for deduplication. Numbers are keyed by their bits so 0 and
+// -0 stay distinct.
+func constantKey(value Value) any {
+	if number, ok := value.(Number); ok {
+		return math.Float64bits(float64(number))
+	}
+	return value
+}
+
+func (c *Chunk) addConstant(value Value) (int, error) {
+	key := constantKey(value)
+	if index, ok := c.constantIndexes[key]; ok {
+		return index, nil
+	}
+	if c.constantIndexes == nil {
+		c.constantIndexes = make(map[any]int)
+	}
+
+	if len(c.Constants) > maxOperand {
+		return 0, fmt.Errorf("too many constants in one chunk")
+	}
+	c.Constants = append(c.Constants, value)
+	c.constantIndexes[key] = len(c.Constants) - 1
+	return len(c.Constants) - 1, nil
+}
+
+func formatConstant(value Value) string {
+	switch v := value.(type) {
+	case Number:
+		return scanner.FormatNumber(float64(v))
+	case String:
+		return `"` + string(v) + `"`
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (c *Chunk) disassembleInstruction(builder *strings.Builder, offset int) int {
+	builder.WriteString(fmt.Sprintf("%04d ", offset))
+	if offset > 0 && c.Lines[offset] == c.Lines[offset-1] {
+		builder.WriteString("   | ")
+	} else {
+		builder.WriteString(fmt.Sprintf("%4d ", c.Lines[offset]))
+	}
+
+	op := OpCode(c.Code[offset])
+	name, ok := opCodeNames[op]
+	if !ok {
+		builder.WriteString(fmt.Sprintf("Unknown opcode %d\n", op))
+		return offset + 1
+	}
+
+	switch op {
+	case OpConstant, OpGetGlobal:
+		constant := c.readOperand(offset + 1)
+		builder.WriteString(fmt.Sprintf("%-16s %4d %s\n", name, constant, formatConstant(c.Constants[constant])))
+	case OpJump, OpJumpIfFalse:
+		jump := c.readOperand(offset + 1)
+		builder.WriteString(fmt.Sprintf("%-16s %4d -> %d\n", name, offset, offset+3+jump))
+	case OpList, OpMap, OpConcat, OpCall:
+		builder.WriteString(fmt.Sprintf("%-16s %4d\n", name, c.readOperand(offset+1)))
+	default:
+		builder.WriteString(name + "\n")
+	}
+	return offset + 1 + opCodeOperands[op]
+}
+
+func (c *Chunk) Disassemble(name string) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("== %s ==\n", name))
+	for offset := 0; offset < len(c.Code); {
+		offset = c.disassembleInstruction(&builder, offset)
+	}
+	return builder.String()
+}
@@ -0,0 +1,322 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+type Compiler struct {
+	chunk  *Chunk
+	parser *parser.Parser
+	// Expressions dropped because they can never be evaluated
+	Eliminated []ast.Expr
+}
+
+// NewCompiler creates a compiler for expressions parsed by p, which provides their source lines.
+func NewCompiler(p *parser.Parser) *Compiler {
+	return &Compiler{chunk: &Chunk{}, parser: p}
+}
+
+// errorToken returns the token of expr that runtime errors point at: the operator, bracket,
+// parenthesis or name. It is the zero token for expressions that can't fail.
+func errorToken(expr ast.Expr) scanner.Token {
+	var token scanner.Token
+	switch node := expr.(type) {
+	case *ast.Unary:
+		token = node.Operator
+	case *ast.Binary:
+		token = node.Operator
+	case *ast.Logical:
+		token = node.Operator
+	case *ast.Index:
+		token = node.Bracket
+	case *ast.SetIndex:
+		token = node.Bracket
+	case *ast.Slice:
+		token = node.Bracket
+	case *ast.Call:
+		token = node.Paren
+	case *ast.Variable:
+		token = node.Name
+	}
+	return token
+}
+
+// position locates the code for expr. Expressions that can fail are placed at their error token,
+// so a runtime error in "1\n- x" is reported on the line of the operator.
+func (c *Compiler) position(expr ast.Expr) (int, Span) {
+	token := errorToken(expr)
+	if token.Line == 0 {
+		return c.parser.Line(expr), Span{}
+	}
+	return token.Line, Span{token.Column, len(token.Lexeme)}
+}
+
+// limitError reports that the code for expr doesn't fit the bytecode format.
+func (c *Compiler) limitError(expr ast.Expr, message string) *diag.Diagnostic {
+	line, span := c.position(expr)
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     diag.CompileLimit,
+		Message:  message,
+		Line:     line,
+		Column:   span.Column,
+		Length:   span.Length,
+	}
+}
+
+func (c *Compiler) emitOp(op OpCode, expr ast.Expr) {
+	line, span := c.position(expr)
+	c.chunk.writeOp(op, line, span)
+}
+
+func (c *Compiler) emitOpWithOperand(op OpCode, operand int, expr ast.Expr) error {
+	if operand > maxOperand {
+		return c.limitError(expr, fmt.Sprintf("Too many operands for %s.", opCodeNames[op]))
+	}
+	c.emitOp(op, expr)
+	line, span := c.position(expr)
+	c.chunk.writeOperand(operand, line, span)
+	return nil
+}
+
+// emitJump writes a jump with a placeholder offset and returns the position of its operand to
+// patch once the target is known.
+func (c *Compiler) emitJump(op OpCode, expr ast.Expr) int {
+	c.emitOp(op, expr)
+	line, span := c.position(expr)
+	c.chunk.writeOperand(0, line, span)
+	return len(c.chunk.Code) - 2
+}
+
+func (c *Compiler) patchJump(operand int, expr ast.Expr) error {
+	jump := len(c.chunk.Code) - operand - 2
+	if jump > maxOperand {
+		return c.limitError(expr, "Too much code to jump over.")
+	}
+	c.chunk.Code[operand] = byte(jump >> 8)
+	c.chunk.Code[operand+1] = byte(jump)
+	return nil
+}
+
+var binaryOpCodes = map[scanner.TokenType][]OpCode{
+	scanner.EqualEqual:   {OpEqual},
+	scanner.BangEqual:    {OpEqual, OpNot},
+	scanner.Greater:      {OpGreater},
+	scanner.GreaterEqual: {OpGreaterEqual},
+	scanner.Less:         {OpLess},
+	scanner.LessEqual:    {OpLessEqual},
+	scanner.Plus:         {OpAdd},
+	scanner.Minus:        {OpSubtract},
+	scanner.Star:         {OpMultiply},
+	scanner.Slash:        {OpDivide},
+}
+
+func (c *Compiler) emitConstant(value Value, expr ast.Expr) error {
+	constant, err := c.chunk.addConstant(value)
+	if err != nil {
+		return c.limitError(expr, "Too many constants in one chunk.")
+	}
+	return c.emitOpWithOperand(OpConstant, constant, expr)
+}
+
+func (c *Compiler) compileAll(exprs []ast.Expr) error {
+	for _, expr := range exprs {
+		if err := c.compileExpr(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileExpr(expr ast.Expr) error {
+	return ast.Accept[error](expr, exprCompiler{c})
+}
+
+// exprCompiler emits the code for each kind of node. It wraps Compiler so the visitor methods
+// stay out of Compiler's API.
+type exprCompiler struct {
+	*Compiler
+}
+
+func (c exprCompiler) VisitNil(node *ast.Nil) error {
+	c.emitOp(OpNil, node)
+	return nil
+}
+
+func (c exprCompiler) VisitBoolean(node *ast.Boolean) error {
+	if node.Value {
+		c.emitOp(OpTrue, node)
+	} else {
+		c.emitOp(OpFalse, node)
+	}
+	return nil
+}
+
+func (c exprCompiler) VisitNumberLit(node *ast.NumberLit) error {
+	return c.emitConstant(Number(node.Value), node)
+}
+
+func (c exprCompiler) VisitStringLit(node *ast.StringLit) error {
+	return c.emitConstant(String(node.Value), node)
+}
+
+func (c exprCompiler) VisitGrouping(node *ast.Grouping) error {
+	return c.compileExpr(node.Value)
+}
+
+func (c exprCompiler) VisitUnary(node *ast.Unary) error {
+	if err := c.compileExpr(node.Expression); err != nil {
+		return err
+	}
+	if node.Operator.Type == scanner.Minus {
+		c.emitOp(OpNegate, node)
+	} else {
+		c.emitOp(OpNot, node)
+	}
+	return nil
+}
+
+func (c exprCompiler) VisitBinary(node *ast.Binary) error {
+	if err := c.compileAll([]ast.Expr{node.Left, node.Right}); err != nil {
+		return err
+	}
+	ops, ok := binaryOpCodes[node.Operator.Type]
+	if !ok {
+		return fmt.Errorf("unsupported binary operator %s at line %d", node.Operator.Lexeme, node.Operator.Line)
+	}
+	for _, op := range ops {
+		c.emitOp(op, node)
+	}
+	return nil
+}
+
+func (c exprCompiler) VisitLogical(node *ast.Logical) error {
+	return c.compileLogical(node)
+}
+
+func (c exprCompiler) VisitListLit(node *ast.ListLit) error {
+	if err := c.compileAll(node.Elements); err != nil {
+		return err
+	}
+	return c.emitOpWithOperand(OpList, len(node.Elements), node)
+}
+
+func (c exprCompiler) VisitMapLit(node *ast.MapLit) error {
+	for _, entry := range node.Entries {
+		if err := c.compileAll([]ast.Expr{entry.Key, entry.Value}); err != nil {
+			return err
+		}
+	}
+	return c.emitOpWithOperand(OpMap, len(node.Entries), node)
+}
+
+func (c exprCompiler) VisitIndex(node *ast.Index) error {
+	if err := c.compileAll([]ast.Expr{node.Object, node.Index}); err != nil {
+		return err
+	}
+	c.emitOp(OpIndex, node)
+	return nil
+}
+
+func (c exprCompiler) VisitSetIndex(node *ast.SetIndex) error {
+	if err := c.compileAll([]ast.Expr{node.Object, node.Index, node.Value}); err != nil {
+		return err
+	}
+	c.emitOp(OpSetIndex, node)
+	return nil
+}
+
+func (c exprCompiler) VisitSlice(node *ast.Slice) error {
+	if err := c.compileAll([]ast.Expr{node.Object, node.Start, node.End}); err != nil {
+		return err
+	}
+	c.emitOp(OpSlice, node)
+	return nil
+}
+
+func (c exprCompiler) VisitInterpolation(node *ast.Interpolation) error {
+	if err := c.compileAll(node.Parts); err != nil {
+		return err
+	}
+	return c.emitOpWithOperand(OpConcat, len(node.Parts), node)
+}
+
+func (c exprCompiler) VisitVariable(node *ast.Variable) error {
+	name, err := c.chunk.addConstant(String(node.Name.Lexeme))
+	if err != nil {
+		return c.limitError(node, "Too many constants in one chunk.")
+	}
+	return c.emitOpWithOperand(OpGetGlobal, name, node)
+}
+
+func (c exprCompiler) VisitCall(node *ast.Call) error {
+	if err := c.compileAll(append([]ast.Expr{node.Callee}, node.Arguments...)); err != nil {
+		return err
+	}
+	return c.emitOpWithOperand(OpCall, len(node.Arguments), node)
+}
+
+// ConstantTruthiness reports the truthiness of expr when it is known at compile time.
+func ConstantTruthiness(expr ast.Expr) (truthy bool, ok bool) {
+	switch node := expr.(type) {
+	case *ast.Grouping:
+		return ConstantTruthiness(node.Value)
+	case *ast.Nil:
+		return false, true
+	case *ast.Boolean:
+		return node.Value, true
+	case *ast.NumberLit, *ast.StringLit:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// compileLogical short-circuits: the left operand stays on the stack as the result unless the
+// right one has to be evaluated.
+func (c *Compiler) compileLogical(logical *ast.Logical) error {
+	if truthy, ok := ConstantTruthiness(logical.Left); ok {
+		// "false and x" and "true or x" never evaluate x, otherwise the result is just x
+		if truthy == (logical.Operator.Lexeme == "or") {
+			c.Eliminated = append(c.Eliminated, logical.Right)
+			return c.compileExpr(logical.Left)
+		}
+		return c.compileExpr(logical.Right)
+	}
+
+	if err := c.compileExpr(logical.Left); err != nil {
+		return err
+	}
+
+	var endJump int
+	if logical.Operator.Lexeme == "and" {
+		endJump = c.emitJump(OpJumpIfFalse, logical)
+	} else {
+		elseJump := c.emitJump(OpJumpIfFalse, logical)
+		endJump = c.emitJump(OpJump, logical)
+		if err := c.patchJump(elseJump, logical); err != nil {
+			return err
+		}
+	}
+
+	c.emitOp(OpPop, logical)
+	if err := c.compileExpr(logical.Right); err != nil {
+		return err
+	}
+	return c.patchJump(endJump, logical)
+}
+
+// Compile lowers the expression parsed by parser into a chunk that leaves its value on the stack
+// and returns it.
+func (c *Compiler) Compile(expr ast.Expr) (*Chunk, error) {
+	if err := c.compileExpr(expr); err != nil {
+		return nil, err
+	}
+	c.emitOp(OpReturn, expr)
+	return c.chunk, nil
+}
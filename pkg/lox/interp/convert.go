@@ -0,0 +1,210 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+var UnsupportedValueError = errors.New("unsupported value")
+
+// ToValue converts a Go value into a Lox value. nil becomes Nil, []byte becomes Bytes, *big.Int
+// becomes a BigInt, other numbers of any kind become Number, other slices and arrays become lists
+// and maps become maps with their keys sorted. A slice or map inside itself converts to a list or
+// map inside itself. Lox values are returned as is.
+func ToValue(v any) (Value, error) {
+	return toValue(v, make(map[builtKey]Value))
+}
+
+// builtKey identifies a Go slice or map by its type and where its contents are. A slice also
+// needs its length, as s and s[:1] share their first element.
+type builtKey struct {
+	valueType reflect.Type
+	pointer   uintptr
+	length    int
+}
+
+// toValue converts v, reusing what the slices and maps in built were already converted to.
+func toValue(v any, built map[builtKey]Value) (Value, error) {
+	switch value := v.(type) {
+	case nil:
+		return Nil{}, nil
+	case Value:
+		return value, nil
+	case func(args []Value) (Value, error):
+		return &NativeFunction{Fn: value}, nil
+	case []byte:
+		if value == nil {
+			return Nil{}, nil
+		}
+		return Bytes(value), nil
+	case *big.Int:
+		if value == nil {
+			return Nil{}, nil
+		}
+		return NewBigInt(value), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Number(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Number(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return Number(rv.Float()), nil
+	case reflect.Bool:
+		return Bool(rv.Bool()), nil
+	case reflect.String:
+		return String(rv.String()), nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Nil{}, nil
+		}
+		return toValue(rv.Elem().Interface(), built)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Nil{}, nil
+		}
+		list := &ListValue{make([]Value, rv.Len())}
+		// An array is copied into v, so only a slice can be inside itself
+		if rv.Kind() == reflect.Slice {
+			key := builtKey{rv.Type(), rv.Pointer(), rv.Len()}
+			if value, ok := built[key]; ok {
+				return value, nil
+			}
+			built[key] = list
+		}
+		for i := range list.Elements {
+			element, err := toValue(rv.Index(i).Interface(), built)
+			if err != nil {
+				return nil, err
+			}
+			list.Elements[i] = element
+		}
+		return list, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return Nil{}, nil
+		}
+		key := builtKey{rv.Type(), rv.Pointer(), 0}
+		if value, ok := built[key]; ok {
+			return value, nil
+		}
+		mapValue := NewMapValue()
+		built[key] = mapValue
+		if err := fillMap(mapValue, rv, built); err != nil {
+			return nil, err
+		}
+		return mapValue, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", UnsupportedValueError, v)
+	}
+}
+
+// fillMap converts the entries of the Go map rv into mapValue.
+func fillMap(mapValue *MapValue, rv reflect.Value, built map[builtKey]Value) error {
+	type entry struct {
+		key   Value
+		value Value
+	}
+	entries := make([]entry, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := toValue(iter.Key().Interface(), built)
+		if err != nil {
+			return err
+		}
+		if checkMapKey(key) != nil {
+			return fmt.Errorf("%w: map key %T", UnsupportedValueError, iter.Key().Interface())
+		}
+		value, err := toValue(iter.Value().Interface(), built)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key, value})
+	}
+
+	// Go maps are unordered, so sort the keys to keep printing deterministic
+	sort.Slice(entries, func(i, j int) bool {
+		return keyLess(entries[i].key, entries[j].key)
+	})
+	for _, e := range entries {
+		mapValue.Set(e.key, e.value)
+	}
+	return nil
+}
+
+// keyLess orders map keys booleans first, then numbers, then strings.
+func keyLess(a Value, b Value) bool {
+	rank := func(key Value) int {
+		switch key.(type) {
+		case Bool:
+			return 0
+		case Number:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	switch a := a.(type) {
+	case Bool:
+		return bool(!a && b.(Bool))
+	case Number:
+		return a < b.(Number)
+	default:
+		return a.(String) < b.(String)
+	}
+}
+
+// FromValue converts a Lox value into plain Go values: nil, bool, float64, string, []byte and
+// *big.Int, with lists becoming []any and maps becoming map[any]any, recursively. A list or map
+// inside itself converts to a slice or map inside itself. Native functions are returned as is.
+func FromValue(value Value) any {
+	return fromValue(value, make(map[Value]any))
+}
+
+// fromValue converts value, reusing what the lists and maps in built were already converted to.
+func fromValue(value Value, built map[Value]any) any {
+	switch v := value.(type) {
+	case Nil:
+		return nil
+	case Bool:
+		return bool(v)
+	case Number:
+		return float64(v)
+	case String:
+		return string(v)
+	case *BigInt:
+		return v.Int()
+	case Bytes:
+		return []byte(v)
+	case *ListValue:
+		if elements, ok := built[v]; ok {
+			return elements
+		}
+		elements := make([]any, len(v.Elements))
+		built[v] = elements
+		for i, element := range v.Elements {
+			elements[i] = fromValue(element, built)
+		}
+		return elements
+	case *MapValue:
+		if entries, ok := built[v]; ok {
+			return entries
+		}
+		entries := make(map[any]any, v.Len())
+		built[v] = entries
+		for _, key := range v.keys {
+			entries[fromValue(key, built)] = fromValue(v.entries[key], built)
+		}
+		return entries
+	default:
+		return v
+	}
+}
@@ -0,0 +1,204 @@
+package interp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// Interpreter evaluates Lox source for programs embedding it. Its VM is kept between calls, so
+// repeated evaluations reuse the same environment. Interpreters share no state, so separate
+// instances can run in parallel; calls on a single instance are serialized.
+type Interpreter struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	limits   Limits
+	optimize bool
+	// Dividing by zero is a runtime error, see VM.EnableDivisionByZeroErrors
+	divisionErrors bool
+	vm             *VM
+	stdout         io.Writer
+	stderr         io.Writer
+	stdin          io.Reader
+	args           []string
+	// Overrides of the clock and the random seed, nil to keep the defaults
+	now  func() time.Time
+	seed *int64
+}
+
+type Option func(*Interpreter)
+
+// WithContext makes evaluation stop once ctx is cancelled or expires.
+func WithContext(ctx context.Context) Option {
+	return func(in *Interpreter) {
+		in.ctx = ctx
+	}
+}
+
+func WithLimits(limits Limits) Option {
+	return func(in *Interpreter) {
+		in.limits = limits
+	}
+}
+
+// WithOptimizer turns the peephole optimizer on or off. It is on by default.
+func WithOptimizer(enabled bool) Option {
+	return func(in *Interpreter) {
+		in.optimize = enabled
+	}
+}
+
+// WithDivisionByZeroErrors makes dividing by zero a runtime error instead of producing ±Infinity
+// or NaN.
+func WithDivisionByZeroErrors(enabled bool) Option {
+	return func(in *Interpreter) {
+		in.divisionErrors = enabled
+	}
+}
+
+// WithStdout sets where Run prints results and printf writes. It defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stdout = w
+	}
+}
+
+// WithStderr sets the error stream natives get from Stderr. It defaults to os.Stderr. The
+// interpreter never writes errors to it itself, see Compile.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stderr = w
+	}
+}
+
+// WithStdin sets the input readLine and other natives read from. It defaults to os.Stdin. Pass a
+// *bufio.Reader to share buffered input with other readers, see VM.SetInput.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) {
+		in.stdin = r
+	}
+}
+
+// WithArgs sets the command line arguments programs see in ARGS. Every Eval sees the same list,
+// along with any changes earlier ones made to it.
+func WithArgs(args []string) Option {
+	return func(in *Interpreter) {
+		in.args = args
+	}
+}
+
+// WithClock makes clock read the time from now instead of the system clock, so tests can fix it.
+func WithClock(now func() time.Time) Option {
+	return func(in *Interpreter) {
+		in.now = now
+	}
+}
+
+// WithRandomSeed seeds the random natives, making their results repeat between runs.
+func WithRandomSeed(seed int64) Option {
+	return func(in *Interpreter) {
+		in.seed = &seed
+	}
+}
+
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		ctx:      context.Background(),
+		optimize: true,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		stdin:    os.Stdin,
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	in.vm = NewVM(in.limits)
+	in.vm.SetInput(in.stdin)
+	in.vm.SetOutput(in.stdout)
+	in.vm.SetArgs(in.args)
+	if in.now != nil {
+		in.vm.SetClock(in.now)
+	}
+	if in.seed != nil {
+		in.vm.SeedRandom(*in.seed)
+	}
+	if in.divisionErrors {
+		in.vm.EnableDivisionByZeroErrors()
+	}
+	return in
+}
+
+// Stdout, Stderr and Stdin give natives access to the streams the interpreter was configured with.
+
+func (in *Interpreter) Stdout() io.Writer { return in.stdout }
+
+func (in *Interpreter) Stderr() io.Writer { return in.stderr }
+
+func (in *Interpreter) Stdin() io.Reader { return in.stdin }
+
+// RegisterNative defines a global function name that calls fn, replacing any previous definition.
+// The interpreter can't tell what fn does, so it is taken to have side effects.
+// fn runs while the interpreter is evaluating, with the instance locked, so it must not call
+// Eval, Run or RegisterNative on the same interpreter: that deadlocks. Use a separate instance
+// for nested evaluation.
+func (in *Interpreter) RegisterNative(name string, fn func(args []Value) (Value, error)) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.vm.defineGlobal(name, &NativeFunction{Name: name, Fn: fn, SideEffects: true})
+}
+
+// Compile scans, parses and compiles src without running it. Errors are only returned, never
+// written out: scan and parse errors wrap a *diag.Diagnostic for each problem, which
+// diag.Diagnostics collects.
+func (in *Interpreter) Compile(src string) (*Chunk, error) {
+	tokens, err := scanner.Scan(in.ctx, bufio.NewReader(strings.NewReader(src)))
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(in.ctx, tokens)
+	expr, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	chunk, err := NewCompiler(p).Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if in.optimize {
+		chunk = Optimize(chunk)
+	}
+	return chunk, nil
+}
+
+// Eval runs src and returns the value it evaluates to. Errors are returned like Compile's, and
+// runtime errors are a *RuntimeError or *LimitError. It must not be called from a native of
+// the same interpreter, see RegisterNative. A program that calls exit stops with an *ExitError.
+func (in *Interpreter) Eval(src string) (Value, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	chunk, err := in.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return in.vm.Run(in.ctx, chunk)
+}
+
+// Run runs src and prints the value it evaluates to. Nothing is printed when the program exits.
+func (in *Interpreter) Run(src string) error {
+	value, err := in.Eval(src)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(in.stdout, FormatValue(value))
+	return err
+}
@@ -0,0 +1,161 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentEval shares one interpreter between goroutines and also runs separate ones in
+// parallel. It is meant to be run with -race.
+func TestConcurrentEval(t *testing.T) {
+	shared := New(WithStderr(io.Discard))
+	shared.RegisterNative("two", func(args []Value) (Value, error) { return Number(2), nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own := New(WithStderr(io.Discard))
+			name := fmt.Sprintf("n%d", i)
+			for j := 0; j < 50; j++ {
+				shared.RegisterNative(name, func(args []Value) (Value, error) { return Number(i), nil })
+				for _, in := range []*Interpreter{shared, own} {
+					value, err := in.Eval(`[1, "a" + "b", {"k": 2}][1] + "${3 * 4}"`)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if got := FormatValue(value); got != "ab12" {
+						t.Errorf("got %s, want ab12", got)
+						return
+					}
+				}
+				value, err := shared.Eval(fmt.Sprintf("two() + %s()", name))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if value != Number(2+i) {
+					t.Errorf("got %s, want %d", FormatValue(value), 2+i)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestToValue(t *testing.T) {
+	var nilSlice []int
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{nil, "nil"},
+		{nilSlice, "nil"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{big.NewInt(7), "7"},
+		{[]byte("hi"), "<bytes 6869>"},
+		{map[any]int{"b": 1, "a": 2, 3.5: 0, true: 4}, "{true: 4, 3.5: 0, a: 2, b: 1}"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T %v", test.in, test.in), func(t *testing.T) {
+			value, err := ToValue(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatValue(value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	for _, unsupported := range []any{make(chan int), map[[1]int]int{{1}: 1}, map[float64]int{math.NaN(): 1}} {
+		if _, err := ToValue(unsupported); !errors.Is(err, UnsupportedValueError) {
+			t.Errorf("%T: got %v, want UnsupportedValueError", unsupported, err)
+		}
+	}
+}
+
+func TestFromValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   any
+		want any
+	}{
+		{nil, nil},
+		{[]int{1, 2}, []any{1.0, 2.0}},
+		{big.NewInt(-3), big.NewInt(-3)},
+		{[]byte("hi"), []byte("hi")},
+		{map[string]any{"a": []string{"b"}}, map[any]any{"a": []any{"b"}}},
+	}
+	for _, test := range tests {
+		value, err := ToValue(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FromValue(value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %#v, want %#v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestToValueCycles(t *testing.T) {
+	s := []any{nil}
+	s[0] = s
+	value, err := ToValue(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, ok := value.(*ListValue); !ok || list.Elements[0] != value {
+		t.Errorf("slice inside itself converted to a %T that isn't itself", value)
+	}
+	if got := FormatValue(value); got != "[[...]]" {
+		t.Errorf("got %s, want [[...]]", got)
+	}
+
+	m := map[string]any{}
+	m["self"] = m
+	m["slice"] = []any{m}
+	value, err = ToValue(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatValue(value); got != "{self: {...}, slice: [{...}]}" {
+		t.Errorf("got %s, want {self: {...}, slice: [{...}]}", got)
+	}
+
+	// Slices sharing their start are different lists
+	shared := []any{1, nil}
+	shared[1] = shared[:1]
+	value, err = ToValue(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatValue(value); got != "[1, [1]]" {
+		t.Errorf("got %s, want [1, [1]]", got)
+	}
+}
+
+func TestFromValueCycles(t *testing.T) {
+	list := &ListValue{}
+	list.Elements = append(list.Elements, list)
+	elements := FromValue(list).([]any)
+	if inner, ok := elements[0].([]any); !ok || &inner[0] != &elements[0] {
+		t.Errorf("list inside itself converted to a %T that isn't itself", elements[0])
+	}
+
+	m := NewMapValue()
+	m.Set(String("self"), m)
+	entries := FromValue(m).(map[any]any)
+	if inner, ok := entries["self"].(map[any]any); !ok || reflect.ValueOf(inner).Pointer() != reflect.ValueOf(entries).Pointer() {
+		t.Errorf("map inside itself converted to a %T that isn't itself", entries["self"])
+	}
+}
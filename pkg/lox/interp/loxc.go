@@ -0,0 +1,311 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// A .loxc file holds one compiled chunk:
+//
+//	magic "LOXC", version byte
+//	code:      uint32 length, bytes
+//	lines:     uint32 run count, (uint32 line, uint32 length) per run
+//	constants: uint32 count, tag byte + payload per constant
+//
+// All integers are big-endian.
+const (
+	loxcMagic   = "LOXC"
+	loxcVersion = 2
+
+	constantNumber byte = 0
+	constantString byte = 1
+)
+
+var InvalidBytecodeError = errors.New("invalid bytecode file")
+
+// IsBytecodeFile tells whether filename is a compiled chunk: it must have the .loxc extension and
+// start with the magic bytes, so a Lox source starting with the identifier LOXC isn't mistaken
+// for one.
+func IsBytecodeFile(filename string) bool {
+	if filepath.Ext(filename) != ".loxc" {
+		return false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(loxcMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return string(header) == loxcMagic
+}
+
+func (c *Chunk) WriteTo(w io.Writer) (int64, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(loxcMagic)
+	buffer.WriteByte(loxcVersion)
+
+	binary.Write(&buffer, binary.BigEndian, uint32(len(c.Code)))
+	buffer.Write(c.Code)
+
+	runs := make([][2]uint32, 0)
+	for _, line := range c.Lines {
+		if len(runs) > 0 && runs[len(runs)-1][0] == uint32(line) {
+			runs[len(runs)-1][1]++
+		} else {
+			runs = append(runs, [2]uint32{uint32(line), 1})
+		}
+	}
+	binary.Write(&buffer, binary.BigEndian, uint32(len(runs)))
+	for _, run := range runs {
+		binary.Write(&buffer, binary.BigEndian, run)
+	}
+
+	binary.Write(&buffer, binary.BigEndian, uint32(len(c.Constants)))
+	for _, constant := range c.Constants {
+		switch value := constant.(type) {
+		case Number:
+			buffer.WriteByte(constantNumber)
+			binary.Write(&buffer, binary.BigEndian, math.Float64bits(float64(value)))
+		case String:
+			buffer.WriteByte(constantString)
+			binary.Write(&buffer, binary.BigEndian, uint32(len(value)))
+			buffer.WriteString(string(value))
+		default:
+			return 0, fmt.Errorf("cannot serialize constant %v", constant)
+		}
+	}
+
+	return buffer.WriteTo(w)
+}
+
+// chunkReader reads the binary encoding of a chunk, remembering the first error so callers can
+// check once at the end.
+type chunkReader struct {
+	reader *bufio.Reader
+	err    error
+}
+
+func (cr *chunkReader) uint32() uint32 {
+	var value uint32
+	if cr.err == nil {
+		cr.err = binary.Read(cr.reader, binary.BigEndian, &value)
+	}
+	return value
+}
+
+func (cr *chunkReader) uint64() uint64 {
+	var value uint64
+	if cr.err == nil {
+		cr.err = binary.Read(cr.reader, binary.BigEndian, &value)
+	}
+	return value
+}
+
+func (cr *chunkReader) byte() byte {
+	var value byte
+	if cr.err == nil {
+		value, cr.err = cr.reader.ReadByte()
+	}
+	return value
+}
+
+// bytes grows its buffer as data arrives, so a corrupt length can't trigger a huge allocation.
+func (cr *chunkReader) bytes(n uint32) []byte {
+	buffer := bytes.Buffer{}
+	if cr.err == nil {
+		_, cr.err = io.CopyN(&buffer, cr.reader, int64(n))
+	}
+	return buffer.Bytes()
+}
+
+func ReadChunk(r io.Reader) (*Chunk, error) {
+	cr := &chunkReader{reader: bufio.NewReader(r)}
+	if magic := cr.bytes(uint32(len(loxcMagic))); cr.err == nil && string(magic) != loxcMagic {
+		return nil, fmt.Errorf("%w: bad magic", InvalidBytecodeError)
+	}
+	if version := cr.byte(); cr.err == nil && version != loxcVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", InvalidBytecodeError, version)
+	}
+
+	chunk := &Chunk{}
+	chunk.Code = cr.bytes(cr.uint32())
+
+	runs := cr.uint32()
+	chunk.Lines = make([]int, 0, len(chunk.Code))
+	for i := uint32(0); i < runs && cr.err == nil; i++ {
+		line, length := cr.uint32(), cr.uint32()
+		if len(chunk.Lines)+int(length) > len(chunk.Code) {
+			return nil, fmt.Errorf("%w: line table longer than code", InvalidBytecodeError)
+		}
+		for j := uint32(0); j < length; j++ {
+			chunk.Lines = append(chunk.Lines, int(line))
+		}
+	}
+
+	constants := cr.uint32()
+	for i := uint32(0); i < constants && cr.err == nil; i++ {
+		switch tag := cr.byte(); tag {
+		case constantNumber:
+			chunk.Constants = append(chunk.Constants, Number(math.Float64frombits(cr.uint64())))
+		case constantString:
+			chunk.Constants = append(chunk.Constants, String(cr.bytes(cr.uint32())))
+		default:
+			if cr.err == nil {
+				return nil, fmt.Errorf("%w: unknown constant tag %d", InvalidBytecodeError, tag)
+			}
+		}
+	}
+
+	if cr.err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidBytecodeError, cr.err)
+	}
+	if len(chunk.Lines) != len(chunk.Code) {
+		return nil, fmt.Errorf("%w: line table shorter than code", InvalidBytecodeError)
+	}
+	if err := chunk.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidBytecodeError, err)
+	}
+	return chunk, nil
+}
+
+// stackEffect gives how many values the instruction at offset pops and pushes. Jumps that only
+// test the top of the stack count it as popped and pushed back.
+func (c *Chunk) stackEffect(offset int) (int, int) {
+	switch op := OpCode(c.Code[offset]); op {
+	case OpConstant, OpNil, OpTrue, OpFalse, OpZero, OpOne, OpGetGlobal:
+		return 0, 1
+	case OpPop, OpReturn:
+		return 1, 0
+	case OpEqual, OpGreater, OpLess, OpGreaterEqual, OpLessEqual, OpAdd, OpSubtract, OpMultiply, OpDivide, OpIndex:
+		return 2, 1
+	case OpNegate, OpNot, OpJumpIfFalse:
+		return 1, 1
+	case OpSlice, OpSetIndex:
+		return 3, 1
+	case OpList, OpConcat:
+		return c.readOperand(offset + 1), 1
+	case OpMap:
+		return c.readOperand(offset+1) * 2, 1
+	case OpCall:
+		return c.readOperand(offset+1) + 1, 1
+	default:
+		return 0, 0
+	}
+}
+
+// mergeDepth records that the instruction at offset is reached with depth values on the stack.
+// Every path into an instruction has to agree on the depth.
+func mergeDepth(depths []int, offset int, depth int) error {
+	if depths[offset] >= 0 && depths[offset] != depth {
+		return fmt.Errorf("inconsistent stack depth at %d", offset)
+	}
+	depths[offset] = depth
+	return nil
+}
+
+// validate checks that every opcode is known, that its operands stay within the chunk and its
+// constant pool, that jumps land on instructions and that no instruction pops more values than
+// the stack holds.
+func (c *Chunk) validate() error {
+	if len(c.Code) == 0 {
+		return errors.New("empty chunk")
+	}
+
+	// Stack depth before each reachable instruction, -1 where none has been seen. Jumps only go
+	// forward, so every path into an instruction is known by the time it is checked.
+	depths := make([]int, len(c.Code)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+	depths[0] = 0
+	starts := make([]bool, len(c.Code))
+	targets := make([]int, 0)
+
+	offset := 0
+	for offset < len(c.Code) {
+		starts[offset] = true
+		op := OpCode(c.Code[offset])
+		if _, ok := opCodeNames[op]; !ok {
+			return fmt.Errorf("unknown opcode %d at %d", op, offset)
+		}
+		next := offset + 1 + opCodeOperands[op]
+		if next > len(c.Code) {
+			return fmt.Errorf("truncated instruction at %d", offset)
+		}
+
+		switch op {
+		case OpConstant, OpGetGlobal:
+			if c.readOperand(offset+1) >= len(c.Constants) {
+				return fmt.Errorf("constant out of range at %d", offset)
+			}
+		case OpJump, OpJumpIfFalse:
+			if next+c.readOperand(offset+1) >= len(c.Code) {
+				return fmt.Errorf("jump out of range at %d", offset)
+			}
+			targets = append(targets, next+c.readOperand(offset+1))
+		}
+
+		if next == len(c.Code) && op != OpReturn {
+			return errors.New("chunk does not end with a return")
+		}
+
+		// Unreachable instructions never run, so only reachable ones need a valid stack
+		if depth := depths[offset]; depth >= 0 {
+			pops, pushes := c.stackEffect(offset)
+			if depth < pops {
+				return fmt.Errorf("stack underflow at %d", offset)
+			}
+			depth += pushes - pops
+			if op == OpJump || op == OpJumpIfFalse {
+				if err := mergeDepth(depths, next+c.readOperand(offset+1), depth); err != nil {
+					return err
+				}
+			}
+			if op != OpJump && op != OpReturn {
+				if err := mergeDepth(depths, next, depth); err != nil {
+					return err
+				}
+			}
+		}
+		offset = next
+	}
+
+	for _, target := range targets {
+		if !starts[target] {
+			return fmt.Errorf("jump into an instruction at %d", target)
+		}
+	}
+	return nil
+}
+
+func WriteChunkFile(chunk *Chunk, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := chunk.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func ReadChunkFile(filename string) (*Chunk, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadChunk(file)
+}
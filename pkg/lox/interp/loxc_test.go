@@ -0,0 +1,166 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	for _, src := range []string{
+		"1 + 2 * 3",
+		`"héllo" + "${1 + 1} world"`,
+		`[1, "a", {"k": -0, true: nil}][2]["k"]`,
+		`nil or false or "third"`,
+		"true and 0 and 1",
+		`[push(ARGS, 1), ARGS[0] = 2, ARGS][2][0:1]`,
+		`len(str(12.5)) - -1`,
+	} {
+		t.Run(src, func(t *testing.T) {
+			chunk, err := New(WithStderr(io.Discard)).Compile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var encoded bytes.Buffer
+			if _, err := chunk.WriteTo(&encoded); err != nil {
+				t.Fatal(err)
+			}
+			read, err := ReadChunk(&encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read.Code, chunk.Code) || !reflect.DeepEqual(read.Lines, chunk.Lines) || !reflect.DeepEqual(read.Constants, chunk.Constants) {
+				t.Errorf("read back\n%s\nwant\n%s", read.Disassemble("read"), chunk.Disassemble("written"))
+			}
+
+			want, wantErr := New(WithStderr(io.Discard)).Eval(src)
+			got, err := NewVM(Limits{}).Run(context.Background(), read)
+			if (err == nil) != (wantErr == nil) || (err == nil && FormatValue(got) != FormatValue(want)) {
+				t.Errorf("got %v, %v, want %v, %v", got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestChunkFile(t *testing.T) {
+	chunk, err := New(WithStderr(io.Discard)).Compile("1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sum.loxc")
+	if err := WriteChunkFile(chunk, filename); err != nil {
+		t.Fatal(err)
+	}
+	if !IsBytecodeFile(filename) {
+		t.Errorf("%s is not recognized as bytecode", filename)
+	}
+	if _, err := ReadChunkFile(filename); err != nil {
+		t.Errorf("reading %s: %v", filename, err)
+	}
+
+	// Only the magic, not the extension, makes a file bytecode, and bytecode needs the extension
+	magic := filepath.Join(dir, "magic.loxc")
+	if err := os.WriteFile(magic, []byte("LOXC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadChunkFile(magic); !errors.Is(err, InvalidBytecodeError) {
+		t.Errorf("a file holding only the magic: got %v, want an invalid bytecode error", err)
+	}
+	source := filepath.Join(dir, "source.loxc")
+	if err := os.WriteFile(source, []byte("LOX + 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(dir, "sum.lox")
+	if err := os.Rename(filename, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if IsBytecodeFile(source) || IsBytecodeFile(renamed) {
+		t.Error("a source with the .loxc extension, or bytecode without it, is taken for bytecode")
+	}
+}
+
+// encodeTestChunk encodes code and constants with one line per byte.
+func encodeTestChunk(t *testing.T, code []byte, constants ...Value) []byte {
+	t.Helper()
+	chunk := &Chunk{Code: code, Lines: make([]int, len(code)), Constants: constants}
+	for i := range chunk.Lines {
+		chunk.Lines[i] = 1
+	}
+	var encoded bytes.Buffer
+	if _, err := chunk.WriteTo(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func TestReadChunkRejects(t *testing.T) {
+	op := func(ops ...OpCode) []byte {
+		code := make([]byte, 0, len(ops))
+		for _, op := range ops {
+			code = append(code, byte(op))
+		}
+		return code
+	}
+	valid := encodeTestChunk(t, op(OpConstant, 0, 0, OpReturn), Number(1))
+	// The constant tag follows the header, code, a single line run and the constant count
+	tagOffset := 5 + 4 + 4 + 4 + 8 + 4
+	patched := func(offset int, patch ...byte) []byte {
+		data := bytes.Clone(valid)
+		copy(data[offset:], patch)
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bad magic", patched(0, 'L', 'O', 'X', 'D'), "bad magic"},
+		{"old version", patched(4, 1), "unsupported version 1"},
+		{"unknown constant tag", patched(tagOffset, 9), "unknown constant tag 9"},
+		{"line table too long", patched(5+4+4+4+4, 0, 0, 0, 5), "line table longer than code"},
+		{"line table too short", patched(5+4+4+4+4, 0, 0, 0, 3), "line table shorter than code"},
+		{"empty", encodeTestChunk(t, nil), "empty chunk"},
+		{"unknown opcode", encodeTestChunk(t, []byte{200, byte(OpReturn)}), "unknown opcode 200 at 0"},
+		{"truncated instruction", encodeTestChunk(t, op(OpConstant, 0)), "truncated instruction at 0"},
+		{"constant out of range", encodeTestChunk(t, op(OpConstant, 0, 1, OpReturn), Number(1)), "constant out of range at 0"},
+		{"global out of range", encodeTestChunk(t, op(OpGetGlobal, 0, 0, OpReturn)), "constant out of range at 0"},
+		{"jump out of range", encodeTestChunk(t, op(OpNil, OpJump, 0, 5, OpReturn)), "jump out of range at 1"},
+		{"jump into an instruction", encodeTestChunk(t, op(OpNil, OpJump, 0, 1, OpConstant, 0, 0, OpReturn), Number(1)), "jump into an instruction at 5"},
+		{"no return", encodeTestChunk(t, op(OpNil)), "chunk does not end with a return"},
+		{"stack underflow", encodeTestChunk(t, op(OpPop, OpNil, OpReturn)), "stack underflow at 0"},
+		{"return from an empty stack", encodeTestChunk(t, op(OpReturn)), "stack underflow at 0"},
+		{"set index underflow", encodeTestChunk(t, op(OpNil, OpNil, OpSetIndex, OpReturn)), "stack underflow at 2"},
+		{"inconsistent depth", encodeTestChunk(t, op(OpTrue, OpJumpIfFalse, 0, 1, OpNil, OpReturn)), "inconsistent stack depth at 5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadChunk(bytes.NewReader(test.data))
+			if !errors.Is(err, InvalidBytecodeError) || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an invalid bytecode error mentioning %q", err, test.want)
+			}
+		})
+	}
+
+	// Every prefix of a valid file is rejected, none of them panics
+	for length := range len(valid) {
+		if _, err := ReadChunk(bytes.NewReader(valid[:length])); !errors.Is(err, InvalidBytecodeError) {
+			t.Errorf("first %d bytes: got %v, want an invalid bytecode error", length, err)
+		}
+	}
+
+	// A huge length doesn't allocate up front
+	huge := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(huge[5:], 1<<31)
+	if _, err := ReadChunk(bytes.NewReader(huge)); !errors.Is(err, InvalidBytecodeError) {
+		t.Errorf("huge code length: got %v, want an invalid bytecode error", err)
+	}
+}
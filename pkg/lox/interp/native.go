@@ -0,0 +1,74 @@
+package interp
+
+import "fmt"
+
+// NativeFunction is a Go function that scripts can call. Errors it returns become runtime errors
+// at the call site, and a nil Value it returns is Lox's nil.
+type NativeFunction struct {
+	Name string
+	Fn   func(args []Value) (Value, error)
+	// Params names the arguments, for signature help. A last name ending in "..." stands for any
+	// number of further arguments.
+	Params []string
+	// SideEffects marks natives that act outside the program, on its input and output, the
+	// environment or the process. Calls to them are passed to the VM's OnNativeCall hook.
+	SideEffects bool
+}
+
+// CheckArity fails unless exactly arity arguments were passed.
+func CheckArity(args []Value, arity int) error {
+	if len(args) != arity {
+		return fmt.Errorf("Expected %d arguments but got %d.", arity, len(args))
+	}
+	return nil
+}
+
+// argument returns the i-th argument, failing when fewer were passed.
+func argument(args []Value, i int) (Value, error) {
+	if i < 0 || i >= len(args) {
+		return nil, fmt.Errorf("Expected at least %d arguments but got %d.", i+1, len(args))
+	}
+	return args[i], nil
+}
+
+// NumberArg returns the i-th argument, 0-based, as a number. It fails when the argument is
+// missing or not a number.
+func NumberArg(args []Value, i int) (float64, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return 0, err
+	}
+	number, ok := arg.(Number)
+	if !ok {
+		return 0, fmt.Errorf("Argument %d must be a number.", i+1)
+	}
+	return float64(number), nil
+}
+
+// StringArg returns the i-th argument, 0-based, as a string. It fails when the argument is
+// missing or not a string.
+func StringArg(args []Value, i int) (string, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return "", err
+	}
+	str, ok := arg.(String)
+	if !ok {
+		return "", fmt.Errorf("Argument %d must be a string.", i+1)
+	}
+	return string(str), nil
+}
+
+// BoolArg returns the i-th argument, 0-based, as a boolean. It fails when the argument is
+// missing or not a boolean.
+func BoolArg(args []Value, i int) (bool, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return false, err
+	}
+	boolean, ok := arg.(Bool)
+	if !ok {
+		return false, fmt.Errorf("Argument %d must be a boolean.", i+1)
+	}
+	return bool(boolean), nil
+}
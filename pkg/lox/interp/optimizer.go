@@ -0,0 +1,166 @@
+package interp
+
+import "math"
+
+// instruction is a decoded bytecode instruction. Jumps refer to their target by instruction index
+// so passes can add and remove instructions without recomputing byte offsets.
+type instruction struct {
+	op      OpCode
+	operand int
+	line    int
+	span    Span
+	target  int
+	removed bool
+}
+
+func isJump(op OpCode) bool {
+	return op == OpJump || op == OpJumpIfFalse
+}
+
+func decodeChunk(chunk *Chunk) []instruction {
+	instructions := make([]instruction, 0, len(chunk.Code))
+	indexes := make(map[int]int)
+	offsets := make([]int, 0, len(chunk.Code))
+	for offset := 0; offset < len(chunk.Code); {
+		op := OpCode(chunk.Code[offset])
+		in := instruction{op: op, line: chunk.Lines[offset], span: chunk.spanAt(offset)}
+		if opCodeOperands[op] > 0 {
+			in.operand = chunk.readOperand(offset + 1)
+		}
+		indexes[offset] = len(instructions)
+		offsets = append(offsets, offset)
+		instructions = append(instructions, in)
+		offset += 1 + opCodeOperands[op]
+	}
+
+	for i := range instructions {
+		if isJump(instructions[i].op) {
+			instructions[i].target = indexes[offsets[i]+3+instructions[i].operand]
+		}
+	}
+	return instructions
+}
+
+func encodeChunk(instructions []instruction, constants []Value) *Chunk {
+	offsets := make([]int, len(instructions)+1)
+	offset := 0
+	for i, in := range instructions {
+		offsets[i] = offset
+		if !in.removed {
+			offset += 1 + opCodeOperands[in.op]
+		}
+	}
+	offsets[len(instructions)] = offset
+
+	chunk := &Chunk{}
+	used := make(map[int]int)
+	for i, in := range instructions {
+		if in.removed {
+			continue
+		}
+		chunk.writeOp(in.op, in.line, in.span)
+		switch {
+		case isJump(in.op):
+			chunk.writeOperand(offsets[in.target]-offsets[i]-3, in.line, in.span)
+		case in.op == OpConstant || in.op == OpGetGlobal:
+			// Keep only the constants still referenced, in order of first use
+			constant, ok := used[in.operand]
+			if !ok {
+				constant = len(chunk.Constants)
+				chunk.Constants = append(chunk.Constants, constants[in.operand])
+				used[in.operand] = constant
+			}
+			chunk.writeOperand(constant, in.line, in.span)
+		case opCodeOperands[in.op] > 0:
+			chunk.writeOperand(in.operand, in.line, in.span)
+		}
+	}
+	return chunk
+}
+
+// useSmallConstants replaces loads of 0 and 1 with dedicated opcodes that need no constant.
+func useSmallConstants(instructions []instruction, constants []Value) {
+	for i := range instructions {
+		if instructions[i].op != OpConstant {
+			continue
+		}
+		number, ok := constants[instructions[i].operand].(Number)
+		if !ok || math.Signbit(float64(number)) {
+			continue
+		}
+		switch number {
+		case 0:
+			instructions[i].op = OpZero
+		case 1:
+			instructions[i].op = OpOne
+		}
+	}
+}
+
+// threadJumps retargets jumps that land on an equivalent jump to that jump's destination. A
+// conditional jump can follow another one because the tested value is still on the stack.
+func threadJumps(instructions []instruction) {
+	for i := range instructions {
+		in := &instructions[i]
+		if !isJump(in.op) {
+			continue
+		}
+		for hops := 0; hops < len(instructions); hops++ {
+			next := instructions[in.target]
+			if next.op != in.op || next.target == in.target {
+				break
+			}
+			in.target = next.target
+		}
+	}
+}
+
+func isPushOnly(op OpCode) bool {
+	switch op {
+	case OpConstant, OpNil, OpTrue, OpFalse, OpZero, OpOne:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeDeadCode drops values pushed only to be popped, and jumps to the next instruction.
+func removeDeadCode(instructions []instruction) {
+	targeted := make(map[int]bool)
+	for _, in := range instructions {
+		if isJump(in.op) {
+			targeted[in.target] = true
+		}
+	}
+
+	for i := 0; i < len(instructions); i++ {
+		in := &instructions[i]
+		switch {
+		case in.op == OpJump && in.target == i+1:
+			in.removed = true
+		case isPushOnly(in.op) && i+1 < len(instructions) && instructions[i+1].op == OpPop && !targeted[i+1]:
+			in.removed = true
+			instructions[i+1].removed = true
+			i++
+		}
+	}
+
+	// Jumps into removed code continue at the next instruction that is kept
+	for i := range instructions {
+		if !isJump(instructions[i].op) {
+			continue
+		}
+		for instructions[instructions[i].target].removed {
+			instructions[i].target++
+		}
+	}
+}
+
+// Optimize runs the peephole passes over chunk and returns the rewritten chunk.
+func Optimize(chunk *Chunk) *Chunk {
+	instructions := decodeChunk(chunk)
+	useSmallConstants(instructions, chunk.Constants)
+	threadJumps(instructions)
+	removeDeadCode(instructions)
+	return encodeChunk(instructions, chunk.Constants)
+}
@@ -0,0 +1,704 @@
+package interp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type native struct {
+	name string
+	// Names of the arguments; a last one ending in "..." takes any number of further arguments
+	params []string
+	fn     func(args []Value) (Value, error)
+}
+
+// defineStandardLibrary defines the natives and constants every VM starts with. Each native checks
+// its arity before running, so the functions can read their arguments without checking their
+// count.
+func (vm *VM) defineStandardLibrary() {
+	pure := [][]native{stringNatives, mathNatives, listNatives, mapNatives, bytesNatives, typeNatives, assertNatives, conversionNatives, formatNatives, vm.randomNatives(), vm.clockNatives()}
+	effectful := [][]native{processNatives, vm.ioNatives()}
+	for _, natives := range pure {
+		vm.defineNatives(natives, false)
+	}
+	for _, natives := range effectful {
+		vm.defineNatives(natives, true)
+	}
+	vm.SetArgs(nil)
+	vm.defineGlobal("PI", Number(math.Pi))
+	vm.defineGlobal("E", Number(math.E))
+}
+
+// formatArgs renders the format string in args[0] with the values after it. %v stands for the
+// next value, rendered like print does, and %% for a percent sign.
+func formatArgs(args []Value) (string, error) {
+	format, err := StringArg(args, 0)
+	if err != nil {
+		return "", err
+	}
+	values := args[1:]
+	var builder strings.Builder
+	used := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			builder.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch {
+		case i == len(format):
+			return "", errors.New("Format string ends with '%'.")
+		case format[i] == '%':
+			builder.WriteByte('%')
+		case format[i] == 'v':
+			if used == len(values) {
+				return "", fmt.Errorf("Format string needs more than %d values.", len(values))
+			}
+			builder.WriteString(FormatValue(values[used]))
+			used++
+		default:
+			r, _ := utf8.DecodeRuneInString(format[i:])
+			return "", fmt.Errorf("Unknown format verb '%%%c'.", r)
+		}
+	}
+	if used < len(values) {
+		return "", fmt.Errorf("Format string uses %d of %d values.", used, len(values))
+	}
+	return builder.String(), nil
+}
+
+// formatNatives build strings from a format and values, see formatArgs.
+var formatNatives = []native{
+	{"format", []string{"format", "values..."}, func(args []Value) (Value, error) {
+		s, err := formatArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return String(s), nil
+	}},
+}
+
+// processNatives act on the process running the program. Programs can read the environment but not
+// change it, since interpreters in the same process share it.
+var processNatives = []native{
+	{"getenv", []string{"name"}, func(args []Value) (Value, error) {
+		name, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return Nil{}, nil
+		}
+		return String(value), nil
+	}},
+	{"exit", []string{"code"}, func(args []Value) (Value, error) {
+		code, err := IntArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if code < 0 || code > 255 {
+			return nil, errors.New("Exit code must be between 0 and 255.")
+		}
+		return nil, &ExitError{code}
+	}},
+}
+
+// ioNatives are bound to this VM, using its input, output or the context of the running program.
+func (vm *VM) ioNatives() []native {
+	return []native{
+		{"printf", []string{"format", "values..."}, func(args []Value) (Value, error) {
+			s, err := formatArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.WriteString(vm.output, s); err != nil {
+				return nil, fmt.Errorf("Could not write output: %v.", err)
+			}
+			return Nil{}, nil
+		}},
+		{"readLine", nil, func(args []Value) (Value, error) {
+			return vm.readLine()
+		}},
+		{"sleep", []string{"seconds"}, func(args []Value) (Value, error) {
+			seconds, err := NumberArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if !(seconds >= 0) || seconds > math.MaxInt64/float64(time.Second) {
+				return nil, errors.New("Sleep duration must be a non-negative number of seconds.")
+			}
+			timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return Nil{}, nil
+			case <-vm.ctx.Done():
+				return nil, vm.ctx.Err()
+			}
+		}},
+	}
+}
+
+// randomNatives draw from this VM's random number generator.
+func (vm *VM) randomNatives() []native {
+	return []native{
+		{"random", nil, func(args []Value) (Value, error) {
+			return Number(vm.random.Float64()), nil
+		}},
+		{"randomInt", []string{"lo", "hi"}, func(args []Value) (Value, error) {
+			lo, err := IntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			hi, err := IntArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, errors.New("Lower bound must not be above the upper bound.")
+			}
+			return Number(lo + int(vm.randomBelow(uint64(hi)-uint64(lo)+1))), nil
+		}},
+		{"seed", []string{"n"}, func(args []Value) (Value, error) {
+			seed, err := IntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			vm.SeedRandom(int64(seed))
+			return Nil{}, nil
+		}},
+	}
+}
+
+// randomBelow draws uniformly from [0, n), or from every uint64 when n is 0 because the range
+// wrapped around. Ranges that fit in an int draw as Intn does, so seeded programs repeat.
+func (vm *VM) randomBelow(n uint64) uint64 {
+	if n == 0 {
+		return vm.random.Uint64()
+	}
+	if n <= math.MaxInt {
+		return uint64(vm.random.Intn(int(n)))
+	}
+	// More than half of all draws land below n, so this rarely repeats
+	for {
+		if r := vm.random.Uint64(); r < n {
+			return r
+		}
+	}
+}
+
+func (vm *VM) defineNatives(natives []native, sideEffects bool) {
+	for _, n := range natives {
+		fn, params := n.fn, n.params
+		vm.defineGlobal(n.name, &NativeFunction{Name: n.name, Params: params, SideEffects: sideEffects, Fn: func(args []Value) (Value, error) {
+			if err := checkParams(args, params); err != nil {
+				return nil, err
+			}
+			return fn(args)
+		}})
+	}
+}
+
+// checkParams fails unless there is an argument for each parameter. A variadic last parameter may
+// take any number of arguments, none included.
+func checkParams(args []Value, params []string) error {
+	if len(params) > 0 && strings.HasSuffix(params[len(params)-1], "...") {
+		if required := len(params) - 1; len(args) < required {
+			return fmt.Errorf("Expected at least %d arguments but got %d.", required, len(args))
+		}
+		return nil
+	}
+	return CheckArity(args, len(params))
+}
+
+// clockNatives read this VM's clock. clock returns seconds since the Unix epoch, as in jlox.
+func (vm *VM) clockNatives() []native {
+	return []native{
+		{"clock", nil, func(args []Value) (Value, error) {
+			return Number(float64(vm.now().UnixNano()) / float64(time.Second)), nil
+		}},
+	}
+}
+
+// readLine reads the next line of input without its line ending. It returns nil once the input is
+// exhausted, and a last line without a line ending as is.
+func (vm *VM) readLine() (Value, error) {
+	line, err := vm.input.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return Nil{}, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Could not read input: %v.", err)
+	}
+	return String(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")), nil
+}
+
+// IntArg returns the i-th argument, 0-based, as an integer. It fails when the argument is missing,
+// not an integral number or too large for an int.
+func IntArg(args []Value, i int) (int, error) {
+	number, err := NumberArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+	if number != math.Trunc(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("Argument %d must be an integer.", i+1)
+	}
+	// -math.MinInt is a power of two, so unlike math.MaxInt it converts to a float exactly
+	if number < math.MinInt || number >= -float64(math.MinInt) {
+		return 0, fmt.Errorf("Argument %d is out of range.", i+1)
+	}
+	return int(number), nil
+}
+
+// listArg returns the i-th argument, 0-based, as a list. It fails when the argument is missing or
+// not a list.
+func listArg(args []Value, i int) (*ListValue, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := arg.(*ListValue)
+	if !ok {
+		return nil, fmt.Errorf("Argument %d must be a list.", i+1)
+	}
+	return list, nil
+}
+
+// boundedIndex reads the i-th argument as a position in a sequence of the given length, which may
+// be one past its last element when allowEnd is set.
+func boundedIndex(args []Value, i int, length int, allowEnd bool) (int, error) {
+	index, err := IntArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 {
+		return 0, errors.New("Index must not be negative.")
+	}
+	if index > length || (index == length && !allowEnd) {
+		return 0, errors.New("Index out of range.")
+	}
+	return index, nil
+}
+
+// mapArg returns the i-th argument, 0-based, as a map. It fails when the argument is missing or
+// not a map.
+func mapArg(args []Value, i int) (*MapValue, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := arg.(*MapValue)
+	if !ok {
+		return nil, fmt.Errorf("Argument %d must be a map.", i+1)
+	}
+	return m, nil
+}
+
+// mapKeyArg returns the i-th argument, 0-based, failing unless it can be a map key.
+func mapKeyArg(args []Value, i int) (Value, error) {
+	key, err := argument(args, i)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMapKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// stringFunction lifts a string to string function into a native body.
+func stringFunction(fn func(string) string) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return String(fn(s)), nil
+	}
+}
+
+// unaryMath lifts a function of one number into a native body.
+func unaryMath(fn func(float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x, err := NumberArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return Number(fn(x)), nil
+	}
+}
+
+// binaryMath lifts a function of two numbers into a native body.
+func binaryMath(fn func(float64, float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x, err := NumberArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		y, err := NumberArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return Number(fn(x, y)), nil
+	}
+}
+
+// String natives count characters as Unicode code points, like indexing and slicing do.
+var stringNatives = []native{
+	{"len", []string{"value"}, func(args []Value) (Value, error) {
+		switch v := args[0].(type) {
+		case String:
+			return Number(len([]rune(v))), nil
+		case Bytes:
+			return Number(len(v)), nil
+		case *ListValue:
+			return Number(len(v.Elements)), nil
+		case *MapValue:
+			return Number(v.Len()), nil
+		default:
+			return nil, errors.New("Argument 1 must be a string, bytes, list or map.")
+		}
+	}},
+	{"substr", []string{"s", "from", "to"}, func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		from, err := IntArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		to, err := IntArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(s)
+		if from < 0 || to < 0 {
+			return nil, errors.New("Index must not be negative.")
+		}
+		if from > len(runes) || to > len(runes) {
+			return nil, errors.New("Index out of range.")
+		}
+		if from > to {
+			return nil, errors.New("Substring start must not be after its end.")
+		}
+		return String(runes[from:to]), nil
+	}},
+	{"upper", []string{"s"}, stringFunction(strings.ToUpper)},
+	{"lower", []string{"s"}, stringFunction(strings.ToLower)},
+	{"trim", []string{"s"}, stringFunction(strings.TrimSpace)},
+	{"split", []string{"s", "separator"}, func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		separator, err := StringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(s, separator)
+		elements := make([]Value, 0, len(parts))
+		for _, part := range parts {
+			elements = append(elements, String(part))
+		}
+		return &ListValue{elements}, nil
+	}},
+}
+
+// Math natives follow IEEE 754 like the arithmetic operators, so sqrt(-1) is NaN rather than an
+// error.
+var mathNatives = []native{
+	{"sqrt", []string{"x"}, unaryMath(math.Sqrt)},
+	{"abs", []string{"x"}, unaryMath(math.Abs)},
+	{"floor", []string{"x"}, unaryMath(math.Floor)},
+	{"ceil", []string{"x"}, unaryMath(math.Ceil)},
+	{"sin", []string{"x"}, unaryMath(math.Sin)},
+	{"cos", []string{"x"}, unaryMath(math.Cos)},
+	{"min", []string{"a", "b"}, binaryMath(math.Min)},
+	{"max", []string{"a", "b"}, binaryMath(math.Max)},
+	{"pow", []string{"base", "exponent"}, binaryMath(math.Pow)},
+}
+
+// List natives change the list in place. push and insert return the list so calls can be chained,
+// pop and remove return the element they took out.
+var listNatives = []native{
+	{"push", []string{"list", "value"}, func(args []Value) (Value, error) {
+		list, err := listArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		list.Elements = append(list.Elements, args[1])
+		return list, nil
+	}},
+	{"pop", []string{"list"}, func(args []Value) (Value, error) {
+		list, err := listArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(list.Elements) == 0 {
+			return nil, errors.New("Can't pop from an empty list.")
+		}
+		last := list.Elements[len(list.Elements)-1]
+		list.Elements = list.Elements[:len(list.Elements)-1]
+		return last, nil
+	}},
+	{"insert", []string{"list", "index", "value"}, func(args []Value) (Value, error) {
+		list, err := listArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		index, err := boundedIndex(args, 1, len(list.Elements), true)
+		if err != nil {
+			return nil, err
+		}
+		list.Elements = slices.Insert(list.Elements, index, args[2])
+		return list, nil
+	}},
+	{"remove", []string{"list", "index"}, func(args []Value) (Value, error) {
+		list, err := listArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		index, err := boundedIndex(args, 1, len(list.Elements), false)
+		if err != nil {
+			return nil, err
+		}
+		removed := list.Elements[index]
+		list.Elements = slices.Delete(list.Elements, index, index+1)
+		return removed, nil
+	}},
+}
+
+// bytesArg returns the i-th argument, 0-based, as bytes. It fails when the argument is missing or
+// not bytes.
+func bytesArg(args []Value, i int) (Bytes, error) {
+	arg, err := argument(args, i)
+	if err != nil {
+		return "", err
+	}
+	b, ok := arg.(Bytes)
+	if !ok {
+		return "", fmt.Errorf("Argument %d must be bytes.", i+1)
+	}
+	return b, nil
+}
+
+// Bytes natives convert between bytes, strings and hex, and read bytes by index. Indexes count
+// bytes, not characters.
+var bytesNatives = []native{
+	{"bytesFromString", []string{"s"}, func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return Bytes(s), nil
+	}},
+	{"bytesToString", []string{"b"}, func(args []Value) (Value, error) {
+		b, err := bytesArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.ValidString(string(b)) {
+			return nil, errors.New("Bytes are not valid UTF-8.")
+		}
+		return String(b), nil
+	}},
+	{"byteAt", []string{"b", "index"}, func(args []Value) (Value, error) {
+		b, err := bytesArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		i, err := boundedIndex(args, 1, len(b), false)
+		if err != nil {
+			return nil, err
+		}
+		return Number(b[i]), nil
+	}},
+	{"sliceBytes", []string{"b", "from", "to"}, func(args []Value) (Value, error) {
+		b, err := bytesArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		from, err := boundedIndex(args, 1, len(b), true)
+		if err != nil {
+			return nil, err
+		}
+		to, err := boundedIndex(args, 2, len(b), true)
+		if err != nil {
+			return nil, err
+		}
+		if from > to {
+			return nil, errors.New("Slice start must not be after its end.")
+		}
+		return b[from:to], nil
+	}},
+	{"hexEncode", []string{"b"}, func(args []Value) (Value, error) {
+		b, err := bytesArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return String(hex.EncodeToString([]byte(b))), nil
+	}},
+	{"hexDecode", []string{"s"}, func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, errors.New("Invalid hex string.")
+		}
+		return Bytes(b), nil
+	}},
+}
+
+// Map natives list keys and values in insertion order, the order maps print in. delete changes the
+// map in place and returns it, whether or not the key was there.
+var mapNatives = []native{
+	{"keys", []string{"m"}, func(args []Value) (Value, error) {
+		m, err := mapArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &ListValue{m.Keys()}, nil
+	}},
+	{"values", []string{"m"}, func(args []Value) (Value, error) {
+		m, err := mapArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]Value, 0, m.Len())
+		for _, key := range m.keys {
+			values = append(values, m.entries[key])
+		}
+		return &ListValue{values}, nil
+	}},
+	{"has", []string{"m", "key"}, func(args []Value) (Value, error) {
+		m, err := mapArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		key, err := mapKeyArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		_, ok := m.Get(key)
+		return Bool(ok), nil
+	}},
+	{"delete", []string{"m", "key"}, func(args []Value) (Value, error) {
+		m, err := mapArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		key, err := mapKeyArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		m.Delete(key)
+		return m, nil
+	}},
+}
+
+// typeNatives name the kind of a value, so programs can branch on it.
+var typeNatives = []native{
+	{"type", []string{"value"}, func(args []Value) (Value, error) {
+		switch value := args[0].(type) {
+		case Number:
+			return String("number"), nil
+		case String:
+			return String("string"), nil
+		case Bool:
+			return String("bool"), nil
+		case Nil:
+			return String("nil"), nil
+		case *BigInt:
+			return String("bigint"), nil
+		case Bytes:
+			return String("bytes"), nil
+		case *ListValue:
+			return String("list"), nil
+		case *MapValue:
+			return String("map"), nil
+		case *NativeFunction:
+			return String("function"), nil
+		default:
+			// Values are sealed, so this is a value type added without a name here
+			panic(fmt.Sprintf("type: unknown value %T", value))
+		}
+	}},
+}
+
+// assertNatives let test scripts check themselves: a falsey condition is a runtime error with the
+// given message.
+var assertNatives = []native{
+	{"assert", []string{"condition", "message"}, func(args []Value) (Value, error) {
+		message, err := StringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(args[0]) {
+			return nil, errors.New(message)
+		}
+		return Nil{}, nil
+	}},
+}
+
+// numberSyntax is a Lox number literal, optionally negated.
+var numberSyntax = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// conversionNatives turn numbers and strings into big integers, strings into numbers and any value
+// into the string print shows for it.
+// num only accepts Lox number syntax, surrounded by whitespace or not, and gives nil for anything
+// else so programs can check input they parse.
+var conversionNatives = []native{
+	{"bigint", []string{"value"}, func(args []Value) (Value, error) {
+		switch v := args[0].(type) {
+		case *BigInt:
+			return v, nil
+		case Number:
+			if math.IsInf(float64(v), 0) || float64(v) != math.Trunc(float64(v)) {
+				return nil, errors.New("Argument 1 must be an integer.")
+			}
+			value, _ := big.NewFloat(float64(v)).Int(nil)
+			return &BigInt{value}, nil
+		case String:
+			value, ok := new(big.Int).SetString(strings.TrimSpace(string(v)), 10)
+			if !ok {
+				return nil, fmt.Errorf("Invalid integer %q.", string(v))
+			}
+			return &BigInt{value}, nil
+		default:
+			return nil, errors.New("Argument 1 must be a number or a string.")
+		}
+	}},
+	{"num", []string{"s"}, func(args []Value) (Value, error) {
+		s, err := StringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		s = strings.TrimSpace(s)
+		if !numberSyntax.MatchString(s) {
+			return Nil{}, nil
+		}
+		number, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Nil{}, nil
+		}
+		return Number(number), nil
+	}},
+	{"str", []string{"value"}, func(args []Value) (Value, error) {
+		return String(FormatValue(args[0])), nil
+	}},
+}
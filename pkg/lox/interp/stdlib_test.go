@@ -0,0 +1,399 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stdlibTest is a program and either the value it prints or the runtime error it fails with.
+type stdlibTest struct {
+	src  string
+	want string
+	err  string
+}
+
+func runStdlibTests(t *testing.T, tests []stdlibTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			value, err := eval(t, test.src)
+			if test.err != "" {
+				var runtimeError *RuntimeError
+				if !errors.As(err, &runtimeError) || runtimeError.Message != test.err {
+					t.Fatalf("got %v, want runtime error %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := FormatValue(value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStringNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `len("héllo")`, want: "5"},
+		{src: `len([1, 2])`, want: "2"},
+		{src: `len({"a": 1})`, want: "1"},
+		{src: `len(1)`, err: "Argument 1 must be a string, bytes, list or map."},
+		{src: `len()`, err: "Expected 1 arguments but got 0."},
+		{src: `substr("héllo", 1, 3)`, want: "él"},
+		{src: `substr("abc", 3, 3)`, want: ""},
+		{src: `substr("abc", 2, 1)`, err: "Substring start must not be after its end."},
+		{src: `substr("abc", 0, 4)`, err: "Index out of range."},
+		{src: `substr("abc", -1, 2)`, err: "Index must not be negative."},
+		{src: `substr("abc", 0.5, 2)`, err: "Argument 2 must be an integer."},
+		{src: `upper("abc") + lower("DEF")`, want: "ABCdef"},
+		{src: "trim(\"  a b \t\n\")", want: "a b"},
+		{src: `split("a,b,,c", ",")`, want: "[a, b, , c]"},
+		{src: `split("abc", "")`, want: "[a, b, c]"},
+		{src: `upper(1)`, err: "Argument 1 must be a string."},
+	})
+}
+
+func TestMathNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "sqrt(16)", want: "4"},
+		{src: "sqrt(2)", want: "1.4142135623730951"},
+		{src: "sqrt(-1)", want: "NaN"},
+		{src: "abs(-2.5)", want: "2.5"},
+		{src: "floor(1.7) + ceil(1.2)", want: "3"},
+		{src: "floor(-0.5)", want: "-1"},
+		{src: "min(1, 2)", want: "1"},
+		{src: "max(1, 2)", want: "2"},
+		{src: "pow(2, 10)", want: "1024"},
+		{src: "sin(0) + cos(0)", want: "1"},
+		{src: "PI", want: "3.141592653589793"},
+		{src: "E", want: "2.718281828459045"},
+		{src: `sqrt("4")`, err: "Argument 1 must be a number."},
+		{src: `pow(2, nil)`, err: "Argument 2 must be a number."},
+		{src: "max(1)", err: "Expected 2 arguments but got 1."},
+	})
+}
+
+func TestListNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "push([1], 2)", want: "[1, 2]"},
+		{src: "push(push([], 1), 2)", want: "[1, 2]"},
+		{src: "push(ARGS, ARGS)", want: "[[...]]"},
+		{src: `"${push(push(ARGS, 1), ARGS)}"`, want: "[1, [...]]"},
+		{src: "[push(ARGS, 1), ARGS]", want: "[[1], [1]]"},
+		{src: "pop([1, 2])", want: "2"},
+		{src: "pop([])", err: "Can't pop from an empty list."},
+		{src: "insert([1, 3], 1, 2)", want: "[1, 2, 3]"},
+		{src: "insert([1], 1, 2)", want: "[1, 2]"},
+		{src: "insert([1], 2, 2)", err: "Index out of range."},
+		{src: "remove([1, 2, 3], 1)", want: "2"},
+		{src: "len(insert([1, 2, 3], 0, 0)) + remove([4, 5], 0)", want: "8"},
+		{src: "remove([1], 1)", err: "Index out of range."},
+		{src: "remove([1], -1)", err: "Index must not be negative."},
+		{src: "remove([1], 0.5)", err: "Argument 2 must be an integer."},
+		{src: `push("a", 1)`, err: "Argument 1 must be a list."},
+		{src: "pop()", err: "Expected 1 arguments but got 0."},
+	})
+}
+
+func TestMapNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `keys({"b": 1, "a": 2, 3: 3})`, want: "[b, a, 3]"},
+		{src: `values({"b": 1, "a": 2})`, want: "[1, 2]"},
+		{src: "keys({})", want: "[]"},
+		{src: `has({"a": 1}, "a")`, want: "true"},
+		{src: `has({"a": 1}, "b")`, want: "false"},
+		{src: `has({1: 1}, [])`, err: "Map keys must be strings, numbers or booleans."},
+		{src: `has({1: 1}, 0 / 0)`, err: "Map keys can't be NaN."},
+		{src: `delete({"a": 1, "b": 2, "c": 3}, "b")`, want: "{a: 1, c: 3}"},
+		{src: `keys(delete({"a": 1, "b": 2}, "a"))`, want: "[b]"},
+		{src: `delete({"a": 1}, "z")`, want: "{a: 1}"},
+		{src: "keys([])", err: "Argument 1 must be a map."},
+		{src: "has({})", err: "Expected 2 arguments but got 1."},
+	})
+}
+
+// TestMapOrder checks that maps keep their keys in insertion order wherever they are listed, and
+// that the order doesn't depend on the keys, as Go's map iteration order would.
+func TestMapOrder(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `{"z": 1, 2: 2, "a": 3, true: 4}`, want: "{z: 1, 2: 2, a: 3, true: 4}"},
+		{src: `keys({"z": 1, 2: 2, "a": 3, true: 4})`, want: "[z, 2, a, true]"},
+		{src: `values({"z": 1, 2: 2, "a": 3, true: 4})`, want: "[1, 2, 3, 4]"},
+		{src: `"${ {"b": 1, "a": 2} }"`, want: "{b: 1, a: 2}"},
+		{src: `{"a": 1, "b": 2, "a": 3}`, want: "{a: 3, b: 2}"},
+		{src: `[push(ARGS, {"b": 1}), ARGS[0]["a"] = 2, ARGS[0]["b"] = 3, ARGS[0]][3]`, want: "{b: 3, a: 2}"},
+		{src: `[push(ARGS, {"a": 1, "b": 2}), delete(ARGS[0], "a"), ARGS[0]["a"] = 3, keys(ARGS[0])][3]`, want: "[b, a]"},
+	})
+
+	keys := make([]string, 0, 100)
+	entries := make([]string, 0, 100)
+	for i := range 100 {
+		key := fmt.Sprintf("k%d", (i*37)%100)
+		keys = append(keys, key)
+		entries = append(entries, fmt.Sprintf("%q: %d", key, i))
+	}
+	src := "keys({" + strings.Join(entries, ", ") + "})"
+	want := "[" + strings.Join(keys, ", ") + "]"
+	for range 5 {
+		value, err := eval(t, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FormatValue(value); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	in := New(WithStderr(io.Discard), WithStdin(strings.NewReader("first\r\nsecond\n\nlast")))
+	value, err := in.Eval("[readLine(), readLine(), readLine(), readLine(), readLine()]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatValue(value); got != "[first, second, , last, nil]" {
+		t.Errorf("got %s, want [first, second, , last, nil]", got)
+	}
+}
+
+func TestRandomNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "random() >= 0 and random() < 1", want: "true"},
+		{src: "randomInt(3, 3)", want: "3"},
+		{src: "randomInt(2, 1)", err: "Lower bound must not be above the upper bound."},
+		{src: "randomInt(1, 2.5)", err: "Argument 2 must be an integer."},
+		{src: "randomInt(-9000000000000000000, 9000000000000000000) <= 9000000000000000000", want: "true"},
+		{src: "randomInt(-9223372036854775808, 9223372036854774784) >= -9223372036854775808", want: "true"},
+		{src: "randomInt(0, 9223372036854775808)", err: "Argument 2 is out of range."},
+		{src: "seed(-99999999999999999999)", err: "Argument 1 is out of range."},
+		{src: "seed()", err: "Expected 1 arguments but got 0."},
+	})
+
+	// Seeding makes the sequence repeat, and seeding another interpreter doesn't disturb it
+	src := "[seed(42), random(), randomInt(1, 100), randomInt(-5, 5)]"
+	in := New(WithStderr(io.Discard))
+	first, err := in.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(WithStderr(io.Discard)).Eval("seed(1)"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := in.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FormatValue(first) != FormatValue(second) {
+		t.Errorf("got %s, then %s", FormatValue(first), FormatValue(second))
+	}
+}
+
+func TestBigInts(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `bigint("123456789012345678901234567890") * bigint(10)`, want: "1234567890123456789012345678900"},
+		{src: "bigint(9007199254740993) + bigint(0)", want: "9007199254740992"},
+		{src: `bigint("9007199254740993") + bigint(1)`, want: "9007199254740994"},
+		{src: "bigint(2) - bigint(5)", want: "-3"},
+		{src: "-bigint(-7) / bigint(2)", want: "3"},
+		{src: "bigint(-7) / bigint(2)", want: "-3"},
+		{src: "bigint(1) < bigint(2) and bigint(3) >= bigint(3)", want: "true"},
+		{src: `bigint(" 42 ") == bigint(42)`, want: "true"},
+		{src: "bigint(1) == 1", want: "false"},
+		{src: `type(bigint(1)) + str(bigint(-0))`, want: "bigint0"},
+		{src: "bigint(1) + 1", err: "Operands must both be big integers."},
+		{src: "1 < bigint(1)", err: "Operands must both be big integers."},
+		{src: "bigint(1) / bigint(0)", err: "Division by zero."},
+		{src: "bigint(1.5)", err: "Argument 1 must be an integer."},
+		{src: `bigint("1.5")`, err: `Invalid integer "1.5".`},
+		{src: "bigint(nil)", err: "Argument 1 must be a number or a string."},
+	})
+}
+
+func TestBytesNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `bytesFromString("hé")`, want: "<bytes 68c3a9>"},
+		{src: `len(bytesFromString("hé"))`, want: "3"},
+		{src: `byteAt(bytesFromString("hé"), 2)`, want: "169"},
+		{src: `byteAt(hexDecode("ff"), 1)`, err: "Index out of range."},
+		{src: `hexEncode(sliceBytes(hexDecode("00ff10"), 1, 3))`, want: "ff10"},
+		{src: `sliceBytes(hexDecode("00"), 1, 0)`, err: "Slice start must not be after its end."},
+		{src: `bytesToString(hexDecode("6869"))`, want: "hi"},
+		{src: `bytesToString(hexDecode("ff"))`, err: "Bytes are not valid UTF-8."},
+		{src: `hexDecode("abc")`, err: "Invalid hex string."},
+		{src: `hexDecode("0aFF") == hexDecode("0aff")`, want: "true"},
+		{src: `bytesFromString("a") == "a"`, want: "false"},
+		{src: `type(hexDecode(""))`, want: "bytes"},
+		{src: `hexEncode("ab")`, err: "Argument 1 must be bytes."},
+	})
+}
+
+func TestDeterministicOverrides(t *testing.T) {
+	src := "[clock(), random(), randomInt(1, 1000000)]"
+	newInterpreter := func() *Interpreter {
+		return New(
+			WithStderr(io.Discard),
+			WithClock(func() time.Time { return time.Unix(1500, 250_000_000) }),
+			WithRandomSeed(7),
+		)
+	}
+	first, err := newInterpreter().Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newInterpreter().Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FormatValue(first) != FormatValue(second) {
+		t.Errorf("got %s, then %s", FormatValue(first), FormatValue(second))
+	}
+	if clock := first.(*ListValue).Elements[0]; clock != Number(1500.25) {
+		t.Errorf("got clock %s, want 1500.25", FormatValue(clock))
+	}
+}
+
+func TestTypeNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "type(1)", want: "number"},
+		{src: `type("a")`, want: "string"},
+		{src: "type(true)", want: "bool"},
+		{src: "type(nil)", want: "nil"},
+		{src: "type([])", want: "list"},
+		{src: "type({})", want: "map"},
+		{src: "type(type)", want: "function"},
+		{src: `type(type(1)) == "string"`, want: "true"},
+		{src: "type()", err: "Expected 1 arguments but got 0."},
+	})
+}
+
+func TestAssert(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `assert(1 < 2, "ordered")`, want: "nil"},
+		{src: `assert(0, "zero is truthy")`, want: "nil"},
+		{src: `assert(nil, "no value")`, err: "no value"},
+		{src: `assert(1 > 2, "Expected order.")`, err: "Expected order."},
+		{src: `assert(true, 1)`, err: "Argument 2 must be a string."},
+		{src: `assert(false)`, err: "Expected 2 arguments but got 1."},
+	})
+}
+
+func TestConversionNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `num("42")`, want: "42"},
+		{src: `num(" -1.5 ")`, want: "-1.5"},
+		{src: `num("1.") == nil`, want: "true"},
+		{src: `num("1e3")`, want: "nil"},
+		{src: `num("NaN")`, want: "nil"},
+		{src: `num("")`, want: "nil"},
+		{src: `num(1)`, err: "Argument 1 must be a string."},
+		{src: `str(1.50) + str(nil)`, want: "1.5nil"},
+		{src: `str([1, "a", {true: 0 / 0}])`, want: "[1, a, {true: NaN}]"},
+		{src: `num(str(-0.25))`, want: "-0.25"},
+		{src: "str()", err: "Expected 1 arguments but got 0."},
+	})
+}
+
+func TestFormatNatives(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: `format("x=%v y=%v", 1, "a")`, want: "x=1 y=a"},
+		{src: `format("%v%%", [1.5, nil])`, want: "[1.5, nil]%"},
+		{src: `format("plain")`, want: "plain"},
+		{src: `format("é%v", true)`, want: "étrue"},
+		{src: `format("%v %v", 1)`, err: "Format string needs more than 1 values."},
+		{src: `format("%v", 1, 2)`, err: "Format string uses 1 of 2 values."},
+		{src: `format("%d", 1)`, err: "Unknown format verb '%d'."},
+		{src: `format("100%")`, err: "Format string ends with '%'."},
+		{src: "format(1)", err: "Argument 1 must be a string."},
+		{src: "format()", err: "Expected at least 1 arguments but got 0."},
+	})
+
+	var stdout strings.Builder
+	in := New(WithStderr(io.Discard), WithStdout(&stdout))
+	if err := in.Run(`[printf("%v+%v=", 1, 2), printf("%v ", 3)]`); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "1+2=3 [nil, nil]\n" {
+		t.Errorf("got %q, want %q", got, "1+2=3 [nil, nil]\n")
+	}
+}
+
+func TestExit(t *testing.T) {
+	_, err := eval(t, `["before", exit(3), "after"]`)
+	var exitError *ExitError
+	if !errors.As(err, &exitError) || exitError.Code != 3 {
+		t.Fatalf("got %v, want exit status 3", err)
+	}
+	runStdlibTests(t, []stdlibTest{
+		{src: "exit(256)", err: "Exit code must be between 0 and 255."},
+		{src: "exit(-1)", err: "Exit code must be between 0 and 255."},
+		{src: `exit("1")`, err: "Argument 1 must be a number."},
+	})
+}
+
+func TestGetenv(t *testing.T) {
+	t.Setenv("LOX_TEST_SET", "value")
+	t.Setenv("LOX_TEST_EMPTY", "")
+	runStdlibTests(t, []stdlibTest{
+		{src: `getenv("LOX_TEST_SET")`, want: "value"},
+		{src: `getenv("LOX_TEST_EMPTY") == ""`, want: "true"},
+		{src: `getenv("LOX_TEST_UNSET")`, want: "nil"},
+		{src: "getenv(1)", err: "Argument 1 must be a string."},
+	})
+}
+
+func TestSleep(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "sleep(0.001)", want: "nil"},
+		{src: "sleep(0)", want: "nil"},
+		{src: "sleep(-1)", err: "Sleep duration must be a non-negative number of seconds."},
+		{src: "sleep(0 / 0)", err: "Sleep duration must be a non-negative number of seconds."},
+		{src: "sleep(1 / 0)", err: "Sleep duration must be a non-negative number of seconds."},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(WithStderr(io.Discard), WithContext(ctx)).Eval("sleep(60)")
+	var limitError *LimitError
+	if !errors.As(err, &limitError) || limitError.Message != TimeoutMessage {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("sleep ran for %v after the timeout", elapsed)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "ARGS", want: "[]"},
+	})
+
+	value, err := New(WithStderr(io.Discard), WithArgs([]string{"a", "--b", ""})).Eval("[len(ARGS), ARGS]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatValue(value); got != "[3, [a, --b, ]]" {
+		t.Errorf("got %s, want [3, [a, --b, ]]", got)
+	}
+
+	// ARGS is one list, which programs can change, while the arguments given stay as they were
+	args := []string{"a"}
+	in := New(WithStderr(io.Discard), WithArgs(args))
+	if _, err := in.Eval(`[push(ARGS, "b"), ARGS[0] = "c"]`); err != nil {
+		t.Fatal(err)
+	}
+	value, err = in.Eval("ARGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatValue(value); got != "[c, b]" || args[0] != "a" {
+		t.Errorf("got %s and arguments %q, want [c, b] and [a]", got, args)
+	}
+}
@@ -0,0 +1,221 @@
+package interp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Value is a runtime value. Its variants are Number, String, Bool, Nil, *BigInt, Bytes,
+// *ListValue, *MapValue and *NativeFunction, and no other type can implement it.
+type Value interface {
+	isValue()
+}
+
+type Number float64
+
+type String string
+
+type Bool bool
+
+// Nil is Lox's nil. A nil Value is never valid.
+type Nil struct{}
+
+// BigInt is an arbitrary-precision integer, made by the bigint native. Its value never changes, so
+// operators always produce a new one.
+type BigInt struct {
+	value *big.Int
+}
+
+func NewBigInt(value *big.Int) *BigInt {
+	return &BigInt{new(big.Int).Set(value)}
+}
+
+// Int returns a copy of the integer.
+func (b *BigInt) Int() *big.Int {
+	return new(big.Int).Set(b.value)
+}
+
+// Bytes is immutable binary data. It is kept apart from String so that data which isn't text
+// survives natives and printing unchanged.
+type Bytes string
+
+type ListValue struct {
+	Elements []Value
+}
+
+// MapValue keeps its keys in insertion order so printing a map is deterministic.
+type MapValue struct {
+	keys    []Value
+	entries map[Value]Value
+}
+
+func (Number) isValue()          {}
+func (String) isValue()          {}
+func (Bool) isValue()            {}
+func (Nil) isValue()             {}
+func (*BigInt) isValue()         {}
+func (Bytes) isValue()           {}
+func (*ListValue) isValue()      {}
+func (*MapValue) isValue()       {}
+func (*NativeFunction) isValue() {}
+
+func NewMapValue() *MapValue {
+	return &MapValue{keys: make([]Value, 0), entries: make(map[Value]Value)}
+}
+
+// checkMapKey fails unless key can be a map key. NaN can't: it equals nothing, not even itself, so
+// its entry could never be found again.
+func checkMapKey(key Value) error {
+	switch k := key.(type) {
+	case Number:
+		if math.IsNaN(float64(k)) {
+			return errors.New("Map keys can't be NaN.")
+		}
+		return nil
+	case String, Bool:
+		return nil
+	default:
+		return errors.New("Map keys must be strings, numbers or booleans.")
+	}
+}
+
+func (m *MapValue) Get(key Value) (Value, bool) {
+	value, ok := m.entries[key]
+	return value, ok
+}
+
+func (m *MapValue) Set(key Value, value Value) {
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+// Delete removes key, keeping the remaining keys in order. It reports whether the key was present.
+func (m *MapValue) Delete(key Value) bool {
+	if _, ok := m.entries[key]; !ok {
+		return false
+	}
+	delete(m.entries, key)
+	m.keys = slices.DeleteFunc(m.keys, func(k Value) bool { return k == key })
+	return true
+}
+
+// Keys returns the map's keys in insertion order.
+func (m *MapValue) Keys() []Value {
+	return slices.Clone(m.keys)
+}
+
+func (m *MapValue) Len() int {
+	return len(m.keys)
+}
+
+// valueSize approximates the memory held by a value itself, not counting the values it contains.
+func valueSize(value Value) int {
+	switch v := value.(type) {
+	case String:
+		return 16 + len(v)
+	case Bytes:
+		return 16 + len(v)
+	case *BigInt:
+		return 32 + len(v.value.Bits())*8
+	case *ListValue:
+		return 24 + 16*len(v.Elements)
+	case *MapValue:
+		return 48 + 48*v.Len()
+	default:
+		return 16
+	}
+}
+
+func isTruthy(value Value) bool {
+	switch v := value.(type) {
+	case Nil:
+		return false
+	case Bool:
+		return bool(v)
+	default:
+		return true
+	}
+}
+
+// valuesEqual follows IEEE 754 for numbers: NaN equals nothing, itself included, and 0 equals -0.
+// Big integers are equal when their values are, but never equal to numbers.
+func valuesEqual(a Value, b Value) bool {
+	if x, ok := a.(*BigInt); ok {
+		y, ok := b.(*BigInt)
+		return ok && x.value.Cmp(y.value) == 0
+	}
+	return a == b
+}
+
+// formatNumber prints a number the way Lox programs see it: integral numbers without a fraction,
+// unlike number tokens which always have one. Non-finite numbers print as in jlox, and negative
+// zero keeps its sign.
+func formatNumber(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "Infinity"
+	case math.IsInf(value, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// FormatValue is Lox's stringify: it renders a value as print, evaluation results and string
+// interpolation show it. A list or map inside itself shows as [...] or {...}, as in Python.
+func FormatValue(value Value) string {
+	return formatValue(value, make(map[Value]bool))
+}
+
+// formatValue renders value inside the lists and maps marked in printing.
+func formatValue(value Value, printing map[Value]bool) string {
+	switch v := value.(type) {
+	case Nil:
+		return "nil"
+	case Bool:
+		return strconv.FormatBool(bool(v))
+	case Number:
+		return formatNumber(float64(v))
+	case String:
+		return string(v)
+	case *BigInt:
+		return v.value.String()
+	case Bytes:
+		return "<bytes " + hex.EncodeToString([]byte(v)) + ">"
+	case *ListValue:
+		if printing[v] {
+			return "[...]"
+		}
+		printing[v] = true
+		defer delete(printing, v)
+		elements := make([]string, 0, len(v.Elements))
+		for _, element := range v.Elements {
+			elements = append(elements, formatValue(element, printing))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *MapValue:
+		if printing[v] {
+			return "{...}"
+		}
+		printing[v] = true
+		defer delete(printing, v)
+		entries := make([]string, 0, v.Len())
+		for _, key := range v.keys {
+			entries = append(entries, formatValue(key, printing)+": "+formatValue(v.entries[key], printing))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *NativeFunction:
+		return "<native fn>"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
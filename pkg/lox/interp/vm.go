@@ -0,0 +1,701 @@
+package interp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type RuntimeError struct {
+	Message string
+	Line    int
+	// Span of the token that failed, zero when unknown
+	Span Span
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s\n[line %d]", e.Message, e.Line)
+}
+
+// LimitError aborts a program that exceeded one of the VM's resource limits.
+type LimitError struct {
+	Message string
+	Line    int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s\n[line %d]", e.Message, e.Line)
+}
+
+// ExitError stops a program that called exit. It is not a failure: the host should end with Code
+// as its exit status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+var StackUnderflowError = errors.New("stack underflow")
+
+// TimeoutMessage is the error message used when the context passed to Run expires.
+const TimeoutMessage = "Execution timed out."
+
+// Limits bounds the resources a program may use. Zero means unlimited.
+type Limits struct {
+	MaxSteps int
+	// MaxMemory caps the approximate bytes of strings, lists and maps the program holds at once.
+	// Values that are no longer reachable don't count.
+	MaxMemory int
+}
+
+type VM struct {
+	// Context of the running program, for natives that block
+	ctx       context.Context
+	chunk     *Chunk
+	ip        int
+	stack     []Value
+	limits    Limits
+	steps     int
+	allocated int
+	// Globals live in a flat slice; names map to their slot only for the first lookup in a run
+	globals     []Value
+	globalSlots map[string]int
+	// Slot plus one for each name constant of the running chunk, 0 until it has been looked up
+	globalCache []int
+	// Executed instructions per source line, only tracked once coverage is enabled
+	coverage map[int]int
+	lineHook func(line int) error
+	// Called before each call of a native with side effects
+	nativeHook func(native *NativeFunction, args []Value, line int)
+	// Source line of the last instruction executed, 0 before the first one
+	line int
+	// Dividing by zero is a runtime error instead of producing ±Infinity or NaN
+	divisionErrors bool
+	// Where readLine reads from and printf writes to
+	input  *bufio.Reader
+	output io.Writer
+	// Each VM has its own generator, so seeding one doesn't affect another
+	random *rand.Rand
+	// What clock reads the time from
+	now func() time.Time
+}
+
+// NewVM creates a VM whose globals hold the standard library natives.
+func NewVM(limits Limits) *VM {
+	vm := &VM{
+		stack:       make([]Value, 0, 256),
+		limits:      limits,
+		globalSlots: make(map[string]int),
+		input:       bufio.NewReader(os.Stdin),
+		output:      os.Stdout,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:         time.Now,
+	}
+	vm.defineStandardLibrary()
+	return vm
+}
+
+// Natives returns the natives defined as globals, sorted by name.
+func (vm *VM) Natives() []*NativeFunction {
+	natives := make([]*NativeFunction, 0)
+	for _, global := range vm.globals {
+		if native, ok := global.(*NativeFunction); ok {
+			natives = append(natives, native)
+		}
+	}
+	slices.SortFunc(natives, func(a, b *NativeFunction) int { return strings.Compare(a.Name, b.Name) })
+	return natives
+}
+
+// defineGlobal sets the global name, giving it a slot the first time it is defined.
+func (vm *VM) defineGlobal(name string, value Value) {
+	if slot, ok := vm.globalSlots[name]; ok {
+		vm.globals[slot] = value
+		return
+	}
+	vm.globalSlots[name] = len(vm.globals)
+	vm.globals = append(vm.globals, value)
+}
+
+// SetGlobal defines the global name as value, replacing any previous definition.
+func (vm *VM) SetGlobal(name string, value Value) {
+	vm.defineGlobal(name, value)
+}
+
+// EnableDivisionByZeroErrors makes dividing by zero a runtime error. By default it follows IEEE 754
+// like the reference interpreter, giving ±Infinity or NaN.
+func (vm *VM) EnableDivisionByZeroErrors() {
+	vm.divisionErrors = true
+}
+
+// SetInput makes readLine read from r instead of os.Stdin. Pass a *bufio.Reader that is also read
+// elsewhere, as the REPL does, to share its buffer: otherwise the VM may buffer input ahead of what
+// readLine returned.
+func (vm *VM) SetInput(r io.Reader) {
+	if reader, ok := r.(*bufio.Reader); ok {
+		vm.input = reader
+		return
+	}
+	vm.input = bufio.NewReader(r)
+}
+
+// SetArgs sets the ARGS global to the command line arguments of the program. It is an empty list
+// until then. ARGS is an ordinary list, not a copy made on each read: changes a program makes to it
+// are seen by everything run on vm after, until SetArgs replaces it. args itself is never changed.
+func (vm *VM) SetArgs(args []string) {
+	elements := make([]Value, 0, len(args))
+	for _, arg := range args {
+		elements = append(elements, String(arg))
+	}
+	vm.defineGlobal("ARGS", &ListValue{elements})
+}
+
+// SetClock makes clock read the time from now instead of the system clock, e.g. to fix it in tests.
+func (vm *VM) SetClock(now func() time.Time) {
+	vm.now = now
+}
+
+// SeedRandom seeds the VM's random number generator like seed(n) does, making random and randomInt
+// repeat the same sequence.
+func (vm *VM) SeedRandom(seed int64) {
+	vm.random.Seed(seed)
+}
+
+// SetOutput makes printf write to w instead of os.Stdout.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.output = w
+}
+
+// EnableCoverage makes the VM count the instructions executed on each source line.
+func (vm *VM) EnableCoverage() {
+	vm.coverage = make(map[int]int)
+}
+
+// Coverage returns the hit count of every line with code in chunk, including lines never
+// executed. It is empty unless coverage was enabled before running chunk.
+func (vm *VM) Coverage(chunk *Chunk) map[int]int {
+	hits := make(map[int]int)
+	if vm.coverage == nil {
+		return hits
+	}
+	for _, line := range chunk.Lines {
+		hits[line] = vm.coverage[line]
+	}
+	return hits
+}
+
+// OnLine sets a hook called before the VM starts executing code from a new source line. The hook
+// may block, e.g. to pause at a breakpoint, and an error from it aborts the program.
+func (vm *VM) OnLine(hook func(line int) error) {
+	vm.lineHook = hook
+}
+
+// OnNativeCall sets a hook called before each call of a native with side effects, e.g. to audit
+// what a program does outside itself. args must not be modified.
+func (vm *VM) OnNativeCall(hook func(native *NativeFunction, args []Value, line int)) {
+	vm.nativeHook = hook
+}
+
+// Stack returns a copy of the values on the VM's stack, bottom first.
+func (vm *VM) Stack() []Value {
+	stack := make([]Value, len(vm.stack))
+	copy(stack, vm.stack)
+	return stack
+}
+
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+// pushAllocated pushes a value the program just created, charging its size against the memory
+// limit. Charges only add up, so once they pass the limit the data still reachable is counted
+// again, crediting back whatever was dropped, and only that has to fit.
+func (vm *VM) pushAllocated(value Value) error {
+	vm.allocated += valueSize(value)
+	if vm.limits.MaxMemory > 0 && vm.allocated > vm.limits.MaxMemory {
+		vm.allocated = vm.liveSize(value)
+		if vm.allocated > vm.limits.MaxMemory {
+			return &LimitError{fmt.Sprintf("Memory limit of %d bytes exceeded.", vm.limits.MaxMemory), vm.chunk.Lines[vm.ip-1]}
+		}
+	}
+	vm.push(value)
+	return nil
+}
+
+// liveSize approximates the bytes of strings, lists and maps reachable from the stack and from
+// value, which is about to be pushed. Lists and maps shared between several places count once.
+func (vm *VM) liveSize(value Value) int {
+	seen := make(map[Value]bool)
+	size := 0
+	var walk func(value Value)
+	walk = func(value Value) {
+		switch v := value.(type) {
+		case String, Bytes, *BigInt:
+			size += valueSize(v)
+		case *ListValue:
+			if seen[v] {
+				return
+			}
+			seen[v] = true
+			size += valueSize(v)
+			for _, element := range v.Elements {
+				walk(element)
+			}
+		case *MapValue:
+			if seen[v] {
+				return
+			}
+			seen[v] = true
+			size += valueSize(v)
+			for _, key := range v.keys {
+				walk(key)
+				walk(v.entries[key])
+			}
+		}
+	}
+	for _, onStack := range vm.stack {
+		walk(onStack)
+	}
+	walk(value)
+	return size
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// popN removes the top n values and returns them in the order they were pushed.
+func (vm *VM) popN(n int) []Value {
+	values := make([]Value, n)
+	copy(values, vm.stack[len(vm.stack)-n:])
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return values
+}
+
+func (vm *VM) readByte() byte {
+	b := vm.chunk.Code[vm.ip]
+	vm.ip++
+	return b
+}
+
+func (vm *VM) readOperand() int {
+	operand := vm.chunk.readOperand(vm.ip)
+	vm.ip += 2
+	return operand
+}
+
+func (vm *VM) runtimeError(format string, args ...any) error {
+	// ip already points past the failing instruction
+	return &RuntimeError{fmt.Sprintf(format, args...), vm.chunk.Lines[vm.ip-1], vm.chunk.spanAt(vm.ip - 1)}
+}
+
+func (vm *VM) binaryNumbers() (float64, float64, error) {
+	b, okB := vm.peek(0).(Number)
+	a, okA := vm.peek(1).(Number)
+	if !okA || !okB {
+		return 0, 0, vm.runtimeError("Operands must be numbers.")
+	}
+	vm.popN(2)
+	return float64(a), float64(b), nil
+}
+
+// bigIntOperands reports whether either operand of a binary operator is a big integer, in which
+// case both must be, see bigIntBinary.
+func (vm *VM) bigIntOperands() bool {
+	_, a := vm.peek(1).(*BigInt)
+	_, b := vm.peek(0).(*BigInt)
+	return a || b
+}
+
+// bigIntBinary applies a comparison or arithmetic operator to two big integers. Division truncates
+// toward zero, and dividing by zero is always an error since there is no infinite big integer.
+func (vm *VM) bigIntBinary(op OpCode) error {
+	b, okB := vm.peek(0).(*BigInt)
+	a, okA := vm.peek(1).(*BigInt)
+	if !okA || !okB {
+		return vm.runtimeError("Operands must both be big integers.")
+	}
+	x, y := a.value, b.value
+	result := new(big.Int)
+	switch op {
+	case OpGreater, OpLess, OpGreaterEqual, OpLessEqual:
+		vm.popN(2)
+		cmp := x.Cmp(y)
+		vm.push(Bool((op == OpGreater && cmp > 0) || (op == OpLess && cmp < 0) ||
+			(op == OpGreaterEqual && cmp >= 0) || (op == OpLessEqual && cmp <= 0)))
+		return nil
+	case OpAdd:
+		result.Add(x, y)
+	case OpSubtract:
+		result.Sub(x, y)
+	case OpMultiply:
+		result.Mul(x, y)
+	case OpDivide:
+		if y.Sign() == 0 {
+			return vm.runtimeError("Division by zero.")
+		}
+		result.Quo(x, y)
+	}
+	vm.popN(2)
+	return vm.pushAllocated(&BigInt{result})
+}
+
+// indexValue converts an index operand into a position within a sequence of the given length.
+func (vm *VM) indexValue(index Value, length int, allowEnd bool) (int, error) {
+	value, ok := index.(Number)
+	number := float64(value)
+	if !ok || number != math.Trunc(number) {
+		return 0, vm.runtimeError("Index must be an integer.")
+	}
+	if number < 0 {
+		return 0, vm.runtimeError("Index must not be negative.")
+	}
+	if number > float64(length) || (number == float64(length) && !allowEnd) {
+		return 0, vm.runtimeError("Index out of range.")
+	}
+	return int(number), nil
+}
+
+func (vm *VM) index(object Value, index Value) (Value, error) {
+	switch container := object.(type) {
+	case *ListValue:
+		i, err := vm.indexValue(index, len(container.Elements), false)
+		if err != nil {
+			return nil, err
+		}
+		return container.Elements[i], nil
+	case String:
+		runes := []rune(container)
+		i, err := vm.indexValue(index, len(runes), false)
+		if err != nil {
+			return nil, err
+		}
+		return String(runes[i]), nil
+	case *MapValue:
+		if err := checkMapKey(index); err != nil {
+			return nil, vm.runtimeError("%s", err)
+		}
+		value, ok := container.Get(index)
+		if !ok {
+			return nil, vm.runtimeError("Undefined key '%s'.", FormatValue(index))
+		}
+		return value, nil
+	default:
+		return nil, vm.runtimeError("Only lists, maps and strings can be indexed.")
+	}
+}
+
+// setIndex stores value at index in a list or map. Lists only replace existing elements, while
+// maps add the key if it is new.
+func (vm *VM) setIndex(object Value, index Value, value Value) error {
+	switch container := object.(type) {
+	case *ListValue:
+		i, err := vm.indexValue(index, len(container.Elements), false)
+		if err != nil {
+			return err
+		}
+		container.Elements[i] = value
+		return nil
+	case *MapValue:
+		if err := checkMapKey(index); err != nil {
+			return vm.runtimeError("%s", err)
+		}
+		container.Set(index, value)
+		return nil
+	case String:
+		return vm.runtimeError("Strings can't be changed.")
+	default:
+		return vm.runtimeError("Only lists and maps can be assigned by index.")
+	}
+}
+
+func (vm *VM) slice(object Value, start Value, end Value) (Value, error) {
+	var length int
+	switch container := object.(type) {
+	case *ListValue:
+		length = len(container.Elements)
+	case String:
+		length = len([]rune(container))
+	default:
+		return nil, vm.runtimeError("Only lists and strings can be sliced.")
+	}
+
+	from, err := vm.indexValue(start, length, true)
+	if err != nil {
+		return nil, err
+	}
+	to, err := vm.indexValue(end, length, true)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, vm.runtimeError("Slice start must not be after its end.")
+	}
+
+	if list, ok := object.(*ListValue); ok {
+		elements := make([]Value, to-from)
+		copy(elements, list.Elements[from:to])
+		return &ListValue{elements}, nil
+	}
+	return String([]rune(object.(String))[from:to]), nil
+}
+
+// Run executes chunk until it returns, and gives back the returned value.
+func (vm *VM) Run(ctx context.Context, chunk *Chunk) (Value, error) {
+	vm.ctx = ctx
+	vm.chunk = chunk
+	vm.ip = 0
+	vm.stack = vm.stack[:0]
+	vm.steps = 0
+	vm.allocated = 0
+	vm.line = 0
+	vm.globalCache = make([]int, len(chunk.Constants))
+	if vm.coverage != nil {
+		vm.coverage = make(map[int]int)
+	}
+
+	for {
+		vm.steps++
+		if vm.limits.MaxSteps > 0 && vm.steps > vm.limits.MaxSteps {
+			return nil, &LimitError{fmt.Sprintf("Step budget of %d exceeded.", vm.limits.MaxSteps), chunk.Lines[vm.ip]}
+		}
+		// Checking the context is comparatively slow, so only poll it periodically
+		if vm.steps%1024 == 0 && ctx.Err() != nil {
+			return nil, &LimitError{TimeoutMessage, chunk.Lines[vm.ip]}
+		}
+
+		if vm.coverage != nil {
+			vm.coverage[chunk.Lines[vm.ip]]++
+		}
+		if vm.lineHook != nil && chunk.Lines[vm.ip] != vm.line {
+			vm.line = chunk.Lines[vm.ip]
+			if err := vm.lineHook(vm.line); err != nil {
+				return nil, err
+			}
+		}
+
+		switch op := OpCode(vm.readByte()); op {
+		case OpConstant:
+			vm.push(chunk.Constants[vm.readOperand()])
+		case OpNil:
+			vm.push(Nil{})
+		case OpTrue:
+			vm.push(Bool(true))
+		case OpFalse:
+			vm.push(Bool(false))
+		case OpZero:
+			vm.push(Number(0))
+		case OpOne:
+			vm.push(Number(1))
+		case OpPop:
+			vm.pop()
+		case OpEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(Bool(valuesEqual(a, b)))
+		case OpGreater, OpLess, OpGreaterEqual, OpLessEqual, OpSubtract, OpMultiply, OpDivide:
+			if vm.bigIntOperands() {
+				if err := vm.bigIntBinary(op); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			a, b, err := vm.binaryNumbers()
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case OpGreater:
+				vm.push(Bool(a > b))
+			case OpLess:
+				vm.push(Bool(a < b))
+			case OpGreaterEqual:
+				vm.push(Bool(a >= b))
+			case OpLessEqual:
+				vm.push(Bool(a <= b))
+			case OpSubtract:
+				vm.push(Number(a - b))
+			case OpMultiply:
+				vm.push(Number(a * b))
+			case OpDivide:
+				if b == 0 && vm.divisionErrors {
+					return nil, vm.runtimeError("Division by zero.")
+				}
+				vm.push(Number(a / b))
+			}
+		case OpAdd:
+			if vm.bigIntOperands() {
+				if err := vm.bigIntBinary(op); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			switch b := vm.peek(0).(type) {
+			case Number:
+				a, ok := vm.peek(1).(Number)
+				if !ok {
+					return nil, vm.runtimeError("Operands must be two numbers or two strings.")
+				}
+				vm.popN(2)
+				vm.push(a + b)
+			case String:
+				a, ok := vm.peek(1).(String)
+				if !ok {
+					return nil, vm.runtimeError("Operands must be two numbers or two strings.")
+				}
+				vm.popN(2)
+				if err := vm.pushAllocated(a + b); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, vm.runtimeError("Operands must be two numbers or two strings.")
+			}
+		case OpNegate:
+			if bigInt, ok := vm.peek(0).(*BigInt); ok {
+				vm.pop()
+				if err := vm.pushAllocated(&BigInt{new(big.Int).Neg(bigInt.value)}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			number, ok := vm.peek(0).(Number)
+			if !ok {
+				return nil, vm.runtimeError("Operand must be a number.")
+			}
+			vm.pop()
+			vm.push(-number)
+		case OpNot:
+			vm.push(Bool(!isTruthy(vm.pop())))
+		case OpJump:
+			jump := vm.readOperand()
+			vm.ip += jump
+		case OpJumpIfFalse:
+			jump := vm.readOperand()
+			if !isTruthy(vm.peek(0)) {
+				vm.ip += jump
+			}
+		case OpList:
+			if err := vm.pushAllocated(&ListValue{vm.popN(vm.readOperand())}); err != nil {
+				return nil, err
+			}
+		case OpMap:
+			entries := vm.popN(vm.readOperand() * 2)
+			mapValue := NewMapValue()
+			for i := 0; i < len(entries); i += 2 {
+				if err := checkMapKey(entries[i]); err != nil {
+					return nil, vm.runtimeError("%s", err)
+				}
+				mapValue.Set(entries[i], entries[i+1])
+			}
+			if err := vm.pushAllocated(mapValue); err != nil {
+				return nil, err
+			}
+		case OpIndex:
+			operands := vm.popN(2)
+			value, err := vm.index(operands[0], operands[1])
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := value.(String); ok {
+				// Indexing a string creates a new one-character string
+				err = vm.pushAllocated(value)
+			} else {
+				vm.push(value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case OpSetIndex:
+			operands := vm.popN(3)
+			if err := vm.setIndex(operands[0], operands[1], operands[2]); err != nil {
+				return nil, err
+			}
+			vm.push(operands[2])
+		case OpSlice:
+			operands := vm.popN(3)
+			value, err := vm.slice(operands[0], operands[1], operands[2])
+			if err != nil {
+				return nil, err
+			}
+			if err := vm.pushAllocated(value); err != nil {
+				return nil, err
+			}
+		case OpConcat:
+			builder := strings.Builder{}
+			for _, part := range vm.popN(vm.readOperand()) {
+				builder.WriteString(FormatValue(part))
+			}
+			if err := vm.pushAllocated(String(builder.String())); err != nil {
+				return nil, err
+			}
+		case OpGetGlobal:
+			constant := vm.readOperand()
+			if vm.globalCache[constant] == 0 {
+				name, ok := chunk.Constants[constant].(String)
+				if !ok {
+					return nil, vm.runtimeError("Global name must be a string.")
+				}
+				slot, ok := vm.globalSlots[string(name)]
+				if !ok {
+					return nil, vm.runtimeError("Undefined variable '%s'.", name)
+				}
+				vm.globalCache[constant] = slot + 1
+			}
+			vm.push(vm.globals[vm.globalCache[constant]-1])
+		case OpCall:
+			args := vm.popN(vm.readOperand())
+			native, ok := vm.pop().(*NativeFunction)
+			if !ok {
+				return nil, vm.runtimeError("Can only call functions and classes.")
+			}
+			if vm.nativeHook != nil && native.SideEffects {
+				vm.nativeHook(native, args, chunk.Lines[vm.ip-1])
+			}
+			value, err := native.Fn(args)
+			var exitError *ExitError
+			if errors.As(err, &exitError) {
+				return nil, exitError
+			}
+			if err != nil && ctx.Err() != nil {
+				// The native gave up because the program was cancelled
+				return nil, &LimitError{TimeoutMessage, chunk.Lines[vm.ip-1]}
+			}
+			if err != nil {
+				return nil, vm.runtimeError("%s", err.Error())
+			}
+			if value == nil {
+				// Natives may return a nil Value for Lox's nil
+				value = Nil{}
+			}
+			// Most natives build their result, so it is charged. One handed back as it was is only
+			// overcounted until the charges pass the limit and what is live gets counted again.
+			if err := vm.pushAllocated(value); err != nil {
+				return nil, err
+			}
+		case OpReturn:
+			if len(vm.stack) == 0 {
+				return nil, StackUnderflowError
+			}
+			return vm.pop(), nil
+		default:
+			return nil, fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+}
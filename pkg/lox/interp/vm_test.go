@@ -0,0 +1,186 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func eval(t *testing.T, src string) (Value, error) {
+	t.Helper()
+	return New(WithStderr(io.Discard)).Eval(src)
+}
+
+func TestNonFiniteNumbers(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"0 / 0", "NaN"},
+		{"1 / 0", "Infinity"},
+		{"-1 / 0", "-Infinity"},
+		{"0 / 0 >= 1", "false"},
+		{"0 / 0 <= 1", "false"},
+		{"0 / 0 > 1", "false"},
+		{"0 / 0 < 1", "false"},
+		{"1 / 0 >= 1 / 0", "true"},
+		{"-0", "-0"},
+		{"0 * -1", "-0"},
+		{"0 == -0", "true"},
+		{"-0 >= 0", "true"},
+		{"2 >= 2", "true"},
+		{"1 >= 2", "false"},
+		{"2 <= 2", "true"},
+		{"3 <= 2", "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			value, err := eval(t, test.src)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := FormatValue(value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestComparisonOpcodes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 >= 2", "OP_GREATER_EQUAL"},
+		{"1 <= 2", "OP_LESS_EQUAL"},
+	}
+	for _, test := range tests {
+		chunk, err := New(WithStderr(io.Discard)).Compile(test.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.src, err)
+		}
+		if listing := chunk.Disassemble(test.src); !strings.Contains(listing, test.want) {
+			t.Errorf("%s: no %s in\n%s", test.src, test.want, listing)
+		}
+	}
+}
+
+func TestUnaryOperands(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"![]", "false"},
+		{"![1, 2]", "false"},
+		{"!{}", "false"},
+		{`!{"a": 1}`, "false"},
+		{"!0", "false"},
+		{`!""`, "false"},
+		{"!nil", "true"},
+		{"!!0", "true"},
+		{"-(1)", "-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			value, err := eval(t, test.src)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := FormatValue(value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNegateNonNumber(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{`-"a"`, 1},
+		{"1 +\n-\"a\"", 2},
+		{"[1,\n2,\n-nil]", 3},
+		{"-\n[]", 1},
+	}
+	for _, test := range tests {
+		_, err := eval(t, test.src)
+		var runtimeError *RuntimeError
+		if !errors.As(err, &runtimeError) {
+			t.Fatalf("%q: got %v, want a runtime error", test.src, err)
+		}
+		if runtimeError.Message != "Operand must be a number." || runtimeError.Line != test.line {
+			t.Errorf("%q: got %q on line %d, want line %d", test.src, runtimeError.Message, runtimeError.Line, test.line)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		src      string
+		exceeded bool
+	}{
+		// Each list is dropped once indexed, so only one is ever live
+		{"[1, 2, 3][0] + [4, 5, 6][0] + [7, 8, 9][0] + [10, 11, 12][0]", false},
+		{"[[1, 2, 3], [4, 5, 6], [7, 8, 9], [10, 11, 12]]", true},
+		{`"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" + "b"`, true},
+		// Natives that build their result are charged for it
+		{`len(upper("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))`, true},
+		{`format("%v%v%v", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")`, true},
+		{`len(upper("aaaaaaaaaa")) + len(upper("aaaaaaaaaa"))`, false},
+		// Handing back an existing list is charged again, but only live data counts against the limit
+		{"len(push(push(push(push([], 1), 2), 3), 4))", false},
+	}
+	for _, test := range tests {
+		_, err := New(WithStderr(io.Discard), WithLimits(Limits{MaxMemory: 100})).Eval(test.src)
+		var limitError *LimitError
+		if exceeded := errors.As(err, &limitError); exceeded != test.exceeded {
+			t.Errorf("%s: got %v, want exceeded %v", test.src, err, test.exceeded)
+		}
+	}
+}
+
+func TestOnNativeCall(t *testing.T) {
+	chunk, err := New(WithStderr(io.Discard)).Compile("[len(\"a\"), getenv(\"HOME\"),\nprintf(\"%v\", 1), sqrt(4)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := NewVM(Limits{})
+	vm.SetOutput(io.Discard)
+	calls := make([]string, 0)
+	vm.OnNativeCall(func(native *NativeFunction, args []Value, line int) {
+		calls = append(calls, fmt.Sprintf("%s%s@%d", native.Name, FormatValue(&ListValue{args}), line))
+	})
+	if _, err := vm.Run(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	// Only natives with side effects are reported
+	if got := strings.Join(calls, " "); got != "getenv[HOME]@1 printf[%v, 1]@2" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestSetIndex(t *testing.T) {
+	runStdlibTests(t, []stdlibTest{
+		{src: "[1, 2][1] = 5", want: "5"},
+		{src: "[push(ARGS, 0), ARGS[0] = ARGS[0] + 1, ARGS][2]", want: "[1]"},
+		{src: `[push(ARGS, {"a": 1}), ARGS[0]["b"] = 2, ARGS[0]][2]`, want: "{a: 1, b: 2}"},
+		{src: "[push(ARGS, 0), push(ARGS, 0), ARGS[0] = ARGS[1] = 3, ARGS][3]", want: "[3, 3]"},
+		{src: "[1][1] = 0", err: "Index out of range."},
+		{src: "[1][-1] = 0", err: "Index must not be negative."},
+		{src: "{}[[]] = 0", err: "Map keys must be strings, numbers or booleans."},
+		{src: "{0 / 0: 1}", err: "Map keys can't be NaN."},
+		{src: "{1: 1}[0 / 0]", err: "Map keys can't be NaN."},
+		{src: "{}[0 / 0] = 1", err: "Map keys can't be NaN."},
+		{src: "[{-0: 1}[0], {0: 1}[-0]]", want: "[1, 1]"},
+		{src: `"ab"[0] = "x"`, err: "Strings can't be changed."},
+		{src: "nil[0] = 1", err: "Only lists and maps can be assigned by index."},
+	})
+
+	if _, err := eval(t, "1 + 2 = 3"); err == nil || !strings.Contains(err.Error(), "Invalid assignment target.") {
+		t.Errorf("got %v, want an invalid assignment target error", err)
+	}
+}
@@ -0,0 +1,445 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/ast"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+type Parser struct {
+	tokens  []scanner.Token
+	current int
+	ctx     context.Context
+	// Line where each parsed node starts, used by tooling to report locations
+	lines map[ast.Expr]int
+}
+
+// New creates a parser over tokens. Parsing stops with ctx's error once ctx is done.
+func New(ctx context.Context, tokens []scanner.Token) *Parser {
+	return &Parser{tokens: tokens, current: 0, ctx: ctx}
+}
+
+func (p *Parser) locate(expr ast.Expr, token scanner.Token) ast.Expr {
+	if p.lines == nil {
+		p.lines = make(map[ast.Expr]int)
+	}
+	p.lines[expr] = token.Line
+	return expr
+}
+
+func (p *Parser) Line(expr ast.Expr) int {
+	return p.lines[expr]
+}
+
+// errorAt reports a syntax error at token.
+func (p *Parser) errorAt(token scanner.Token, code string, message string) *diag.Diagnostic {
+	length, where := len(token.Lexeme), fmt.Sprintf("at '%s'", token.Lexeme)
+	if token.Type == scanner.EOF {
+		length, where = 0, "at end"
+	}
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Message:  message,
+		Line:     token.Line,
+		Column:   token.Column,
+		Length:   length,
+		Where:    where,
+	}
+}
+
+func (p *Parser) currentToken() scanner.Token {
+	// Token streams that don't come from Scan may lack a trailing EOF token.
+	if p.current >= len(p.tokens) {
+		line := 1
+		if len(p.tokens) > 0 {
+			line = p.tokens[len(p.tokens)-1].Line
+		}
+		return scanner.NewEOFToken(line)
+	}
+	return p.tokens[p.current]
+}
+
+func (p *Parser) check(tokenType scanner.TokenType) bool {
+	return p.currentToken().Type == tokenType
+}
+
+func (p *Parser) match(tokenType scanner.TokenType) bool {
+	if p.check(tokenType) {
+		p.advance()
+		return true
+	}
+
+	return false
+}
+
+func (p *Parser) matchAny(tokenTypes ...scanner.TokenType) bool {
+	for _, tokenType := range tokenTypes {
+		if p.match(tokenType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Parser) matchKeyword(lexeme string) bool {
+	if p.check(scanner.Keyword) && p.currentToken().Lexeme == lexeme {
+		p.advance()
+		return true
+	}
+
+	return false
+}
+
+func (p *Parser) nextToken() scanner.Token {
+	p.advance()
+	return p.currentToken()
+}
+
+func (p *Parser) previousToken() scanner.Token {
+	return p.tokens[p.current-1]
+}
+
+func (p *Parser) advance() scanner.Token {
+	if !p.isAtEnd() {
+		p.current++
+	}
+	return p.previousToken()
+}
+
+func (p *Parser) consume(tokenType scanner.TokenType, errorMsg string) error {
+	if !p.match(tokenType) {
+		return p.errorAt(p.currentToken(), diag.ExpectToken, errorMsg)
+	}
+	return nil
+}
+
+func (p *Parser) isAtEnd() bool {
+	return p.currentToken().Type == scanner.EOF
+}
+
+func (p *Parser) MatchOr() (ast.Expr, error) {
+	start := p.currentToken()
+	expr, err := p.MatchAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchKeyword("or") {
+		op := p.previousToken()
+		right, err := p.MatchAnd()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.locate(ast.NewLogical(expr, op, right), start)
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) MatchAnd() (ast.Expr, error) {
+	start := p.currentToken()
+	expr, err := p.MatchEquality()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchKeyword("and") {
+		op := p.previousToken()
+		right, err := p.MatchEquality()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.locate(ast.NewLogical(expr, op, right), start)
+	}
+
+	return expr, nil
+}
+
+// matchBinary parses a left-associative chain of operands produced by next, joined by any of the
+// given operators.
+func (p *Parser) matchBinary(next func() (ast.Expr, error), operators ...scanner.TokenType) (ast.Expr, error) {
+	start := p.currentToken()
+	expr, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchAny(operators...) {
+		op := p.previousToken()
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.locate(ast.NewBinary(expr, op, right), start)
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) MatchEquality() (ast.Expr, error) {
+	return p.matchBinary(p.MatchComparison, scanner.EqualEqual, scanner.BangEqual)
+}
+
+func (p *Parser) MatchComparison() (ast.Expr, error) {
+	return p.matchBinary(p.MatchTerm, scanner.Less, scanner.LessEqual, scanner.Greater, scanner.GreaterEqual)
+}
+
+func (p *Parser) MatchTerm() (ast.Expr, error) {
+	return p.matchBinary(p.MatchFactor, scanner.Plus, scanner.Minus)
+}
+
+func (p *Parser) MatchFactor() (ast.Expr, error) {
+	return p.matchBinary(p.MatchUnary, scanner.Star, scanner.Slash)
+}
+
+func (p *Parser) MatchUnary() (ast.Expr, error) {
+	if p.match(scanner.Bang) || p.match(scanner.Minus) {
+		op := p.previousToken()
+		expr, err := p.MatchUnary()
+		if err != nil {
+			return nil, err
+		}
+		res := ast.NewUnary(op, expr)
+		return p.locate(res, op), nil
+	} else {
+		return p.MatchIndex()
+	}
+}
+
+// MatchIndex matches a primary expression followed by any number of indexes, slices and calls.
+func (p *Parser) MatchIndex() (ast.Expr, error) {
+	start := p.currentToken()
+	expr, err := p.MatchPrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.match(scanner.LeftParen) {
+			expr, err = p.MatchCall(expr, start)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !p.match(scanner.LeftBracket) {
+			break
+		}
+
+		bracket := p.previousToken()
+		index, err := p.MatchExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.match(scanner.Colon) {
+			end, err := p.MatchExpr()
+			if err != nil {
+				return nil, err
+			}
+			err = p.consume(scanner.RightBracket, "Expect ']' after slice.")
+			if err != nil {
+				return nil, err
+			}
+			expr = p.locate(ast.NewSlice(expr, bracket, index, end), start)
+			continue
+		}
+
+		err = p.consume(scanner.RightBracket, "Expect ']' after index.")
+		if err != nil {
+			return nil, err
+		}
+		expr = p.locate(ast.NewIndex(expr, bracket, index), start)
+	}
+
+	return expr, nil
+}
+
+// MatchCall matches the arguments of a call to callee, starting after the opening parenthesis.
+func (p *Parser) MatchCall(callee ast.Expr, start scanner.Token) (ast.Expr, error) {
+	paren := p.previousToken()
+	arguments := make([]ast.Expr, 0)
+	if !p.check(scanner.RightParen) {
+		for {
+			argument, err := p.MatchExpr()
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, argument)
+			if !p.match(scanner.Comma) {
+				break
+			}
+		}
+	}
+
+	err := p.consume(scanner.RightParen, "Expect ')' after arguments.")
+	if err != nil {
+		return nil, err
+	}
+	return p.locate(ast.NewCall(callee, paren, arguments), start), nil
+}
+
+func (p *Parser) MatchList() (ast.Expr, error) {
+	start := p.previousToken()
+	elements := make([]ast.Expr, 0)
+	if !p.check(scanner.RightBracket) {
+		for {
+			element, err := p.MatchExpr()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+			if !p.match(scanner.Comma) {
+				break
+			}
+		}
+	}
+
+	err := p.consume(scanner.RightBracket, "Expect ']' after list elements.")
+	if err != nil {
+		return nil, err
+	}
+	return p.locate(ast.NewListLit(elements), start), nil
+}
+
+func (p *Parser) MatchPrimary() (ast.Expr, error) {
+	if p.ctx.Err() != nil {
+		return nil, p.ctx.Err()
+	}
+
+	start := p.currentToken()
+	if p.match(scanner.LeftParen) {
+		expr, err := p.MatchExpr()
+		if err != nil {
+			return nil, err
+		}
+		err = p.consume(scanner.RightParen, "Expect ')' after expression.")
+		if err != nil {
+			return nil, err
+		}
+		return p.locate(ast.NewGrouping(expr), start), nil
+	} else if p.match(scanner.LeftBracket) {
+		return p.MatchList()
+	} else if p.match(scanner.StringInterp) {
+		return p.MatchInterpolation()
+	} else if p.match(scanner.Identifier) {
+		return p.locate(ast.NewVariable(p.previousToken()), start), nil
+	} else if p.match(scanner.LeftBrace) {
+		// There are no blocks in expression position, so a brace here always opens a map literal.
+		return p.MatchMap()
+	} else {
+		lit, err := ast.NewLiteral(p.currentToken())
+		if err != nil {
+			return nil, p.errorAt(p.currentToken(), diag.ExpectExpression, "Expect expression.")
+		}
+		p.advance()
+		return p.locate(lit, start), nil
+	}
+}
+
+func (p *Parser) MatchMap() (ast.Expr, error) {
+	start := p.previousToken()
+	entries := make([]ast.MapEntry, 0)
+	if !p.check(scanner.RightBrace) {
+		for {
+			key, err := p.MatchExpr()
+			if err != nil {
+				return nil, err
+			}
+			err = p.consume(scanner.Colon, "Expect ':' after map key.")
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.MatchExpr()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, ast.MapEntry{Key: key, Value: value})
+			if !p.match(scanner.Comma) {
+				break
+			}
+		}
+	}
+
+	err := p.consume(scanner.RightBrace, "Expect '}' after map entries.")
+	if err != nil {
+		return nil, err
+	}
+	return p.locate(ast.NewMapLit(entries), start), nil
+}
+
+// MatchInterpolation builds the concatenation of the string pieces and embedded expressions of an
+// interpolated string, starting after its first piece.
+func (p *Parser) MatchInterpolation() (ast.Expr, error) {
+	start := p.previousToken()
+	parts := make([]ast.Expr, 0)
+	for {
+		piece, err := ast.NewLiteral(p.previousToken())
+		if err != nil {
+			return nil, p.errorAt(p.previousToken(), diag.ExpectExpression, "Expect expression.")
+		}
+		parts = append(parts, p.locate(piece, p.previousToken()))
+
+		if p.previousToken().Type == scanner.String {
+			return p.locate(ast.NewInterpolation(parts), start), nil
+		}
+
+		expr, err := p.MatchExpr()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if !p.match(scanner.StringInterp) {
+			err = p.consume(scanner.String, "Expect end of string interpolation.")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (p *Parser) MatchExpr() (ast.Expr, error) {
+	return p.MatchAssignment()
+}
+
+// MatchAssignment parses an index assignment, xs[i] = value. It binds looser than any operator and
+// groups to the right, so xs[0] = ys[0] = 1 sets both.
+func (p *Parser) MatchAssignment() (ast.Expr, error) {
+	start := p.currentToken()
+	expr, err := p.MatchOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.match(scanner.Equal) {
+		return expr, nil
+	}
+
+	equals := p.previousToken()
+	value, err := p.MatchAssignment()
+	if err != nil {
+		return nil, err
+	}
+	target, ok := expr.(*ast.Index)
+	if !ok {
+		return nil, p.errorAt(equals, diag.InvalidAssignment, "Invalid assignment target.")
+	}
+	return p.locate(ast.NewSetIndex(target.Object, target.Bracket, target.Index, value), start), nil
+}
+
+// Parse parses a whole program: one expression that takes up every token up to EOF.
+func (p *Parser) Parse() (ast.Expr, error) {
+	expr, err := p.MatchExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isAtEnd() {
+		return nil, p.errorAt(p.currentToken(), diag.ExpectToken, "Expect end of expression.")
+	}
+	return expr, nil
+}
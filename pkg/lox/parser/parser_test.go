@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/scanner"
+)
+
+// fuzzTokens is the vocabulary fuzzed token sequences are drawn from, one token per input byte.
+var fuzzTokens = []scanner.Token{
+	{Type: scanner.LeftParen, Lexeme: "("},
+	{Type: scanner.RightParen, Lexeme: ")"},
+	{Type: scanner.LeftBrace, Lexeme: "{"},
+	{Type: scanner.RightBrace, Lexeme: "}"},
+	{Type: scanner.LeftBracket, Lexeme: "["},
+	{Type: scanner.RightBracket, Lexeme: "]"},
+	{Type: scanner.Star, Lexeme: "*"},
+	{Type: scanner.Comma, Lexeme: ","},
+	{Type: scanner.Plus, Lexeme: "+"},
+	{Type: scanner.Dot, Lexeme: "."},
+	{Type: scanner.Minus, Lexeme: "-"},
+	{Type: scanner.Semicolon, Lexeme: ";"},
+	{Type: scanner.Colon, Lexeme: ":"},
+	{Type: scanner.Equal, Lexeme: "="},
+	{Type: scanner.EqualEqual, Lexeme: "=="},
+	{Type: scanner.Bang, Lexeme: "!"},
+	{Type: scanner.BangEqual, Lexeme: "!="},
+	{Type: scanner.Less, Lexeme: "<"},
+	{Type: scanner.LessEqual, Lexeme: "<="},
+	{Type: scanner.Greater, Lexeme: ">"},
+	{Type: scanner.GreaterEqual, Lexeme: ">="},
+	{Type: scanner.Slash, Lexeme: "/"},
+	{Type: scanner.String, Lexeme: `"s"`, Literal: scanner.NewStringLiteral("s")},
+	{Type: scanner.StringInterp, Lexeme: `"a${`, Literal: scanner.NewStringLiteral("a")},
+	{Type: scanner.String, Lexeme: `}b"`, Literal: scanner.NewStringLiteral("b")},
+	{Type: scanner.Number, Lexeme: "1", Literal: scanner.NewNumberLiteral(1)},
+	{Type: scanner.Identifier, Lexeme: "x"},
+	{Type: scanner.Keyword, Lexeme: "nil"},
+	{Type: scanner.Keyword, Lexeme: "true"},
+	{Type: scanner.Keyword, Lexeme: "and"},
+	{Type: scanner.Keyword, Lexeme: "or"},
+	{Type: scanner.Keyword, Lexeme: "print"},
+	scanner.NewEOFToken(1),
+}
+
+// FuzzParse parses arbitrary token sequences. Parsing must not panic, and must either give an
+// expression or fail with a diagnostic.
+func FuzzParse(f *testing.F) {
+	f.Add([]byte{25, 8, 25})
+	f.Add([]byte{4, 25, 7, 26, 5, 4, 25, 12, 25, 5})
+	f.Add([]byte{2, 22, 12, 25, 3})
+	f.Add([]byte{23, 26, 24, 29, 15, 27})
+	f.Add([]byte{0, 0, 25})
+	f.Add([]byte{25, 25})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tokens := make([]scanner.Token, 0, len(data))
+		for i, b := range data {
+			token := fuzzTokens[int(b)%len(fuzzTokens)]
+			token.Line, token.Column = 1, i+1
+			tokens = append(tokens, token)
+		}
+
+		expr, err := New(context.Background(), tokens).Parse()
+		if err != nil {
+			var diagnostic *diag.Diagnostic
+			if !errors.As(err, &diagnostic) {
+				t.Fatalf("error without a diagnostic: %v", err)
+			}
+			return
+		}
+		if expr == nil {
+			t.Fatal("no expression and no error")
+		}
+	})
+}
@@ -0,0 +1,653 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+)
+
+type TokenType string
+
+const (
+	LeftParen    TokenType = "("
+	RightParen   TokenType = ")"
+	LeftBrace    TokenType = "{"
+	RightBrace   TokenType = "}"
+	LeftBracket  TokenType = "["
+	RightBracket TokenType = "]"
+	Star         TokenType = "*"
+	Comma        TokenType = ","
+	Plus         TokenType = "+"
+	Dot          TokenType = "."
+	Minus        TokenType = "-"
+	Semicolon    TokenType = ";"
+	Colon        TokenType = ":"
+	Equal        TokenType = "="
+	EqualEqual   TokenType = "=="
+	Bang         TokenType = "!"
+	BangEqual    TokenType = "!="
+	Less         TokenType = "<"
+	LessEqual    TokenType = "<="
+	Greater      TokenType = ">"
+	GreaterEqual TokenType = ">="
+	Slash        TokenType = "/"
+	String       TokenType = "STR"
+	StringInterp TokenType = "INTERP"
+	Number       TokenType = "NUM"
+	Identifier   TokenType = "ID"
+	Keyword      TokenType = "KEYWORD"
+	EOF          TokenType = "EOF"
+)
+
+var tokenNames = map[TokenType]string{
+	LeftParen:    "LEFT_PAREN",
+	RightParen:   "RIGHT_PAREN",
+	LeftBrace:    "LEFT_BRACE",
+	RightBrace:   "RIGHT_BRACE",
+	LeftBracket:  "LEFT_BRACKET",
+	RightBracket: "RIGHT_BRACKET",
+	Star:         "STAR",
+	Dot:          "DOT",
+	Comma:        "COMMA",
+	Plus:         "PLUS",
+	Minus:        "MINUS",
+	Semicolon:    "SEMICOLON",
+	Colon:        "COLON",
+	Equal:        "EQUAL",
+	EqualEqual:   "EQUAL_EQUAL",
+	Bang:         "BANG",
+	BangEqual:    "BANG_EQUAL",
+	Less:         "LESS",
+	LessEqual:    "LESS_EQUAL",
+	Greater:      "GREATER",
+	GreaterEqual: "GREATER_EQUAL",
+	Slash:        "SLASH",
+	String:       "STRING",
+	StringInterp: "INTERPOLATION",
+	Number:       "NUMBER",
+	Identifier:   "IDENTIFIER",
+	Keyword:      "KEYWORD",
+	EOF:          "EOF",
+}
+
+var keywords = map[string]interface{}{
+	"and":    struct{}{},
+	"class":  struct{}{},
+	"else":   struct{}{},
+	"false":  struct{}{},
+	"for":    struct{}{},
+	"fun":    struct{}{},
+	"if":     struct{}{},
+	"nil":    struct{}{},
+	"or":     struct{}{},
+	"print":  struct{}{},
+	"return": struct{}{},
+	"super":  struct{}{},
+	"this":   struct{}{},
+	"true":   struct{}{},
+	"var":    struct{}{},
+	"while":  struct{}{},
+}
+
+type literalKind int
+
+const (
+	noLiteral literalKind = iota
+	numberLiteral
+	stringLiteral
+)
+
+// Literal is the value of a number or string token. The zero Literal holds no value, as for every
+// other token. Build one with NewNumberLiteral or NewStringLiteral and read it back with Number or
+// Text, which report whether the literal is of that kind.
+type Literal struct {
+	kind   literalKind
+	number float64
+	text   string
+}
+
+func NewNumberLiteral(value float64) Literal {
+	return Literal{kind: numberLiteral, number: value}
+}
+
+func NewStringLiteral(value string) Literal {
+	return Literal{kind: stringLiteral, text: value}
+}
+
+func (l Literal) Number() (float64, bool) {
+	return l.number, l.kind == numberLiteral
+}
+
+func (l Literal) Text() (string, bool) {
+	return l.text, l.kind == stringLiteral
+}
+
+// String prints the literal as tokenize shows it: numbers with a fractional part, and null when
+// there is no value.
+func (l Literal) String() string {
+	switch l.kind {
+	case numberLiteral:
+		return FormatNumber(l.number)
+	case stringLiteral:
+		return l.text
+	default:
+		return "null"
+	}
+}
+
+type Token struct {
+	Type    TokenType
+	Line    int
+	Lexeme  string
+	Literal Literal
+	// 1-based byte offset of the token within its line, 0 when unknown
+	Column int
+	// Byte offset of the token within the source; the lexeme is the len(Lexeme) bytes from there
+	Offset int
+}
+
+// FormatNumber formats a number literal the way tokens and the AST print it, always with a
+// fractional part.
+func FormatNumber(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+	return formatted
+}
+
+func (t Token) String() string {
+	switch t.Type {
+	case Keyword:
+		return fmt.Sprintf("%s %s %s", strings.ToUpper(t.Lexeme), t.Lexeme, t.Literal)
+	case EOF:
+		return fmt.Sprintf("%s %s %s", strings.ToUpper(t.Lexeme), "", t.Literal)
+	default:
+		return fmt.Sprintf("%s %s %s", tokenNames[t.Type], t.Lexeme, t.Literal)
+	}
+}
+
+func NewEOFToken(line int) Token {
+	return Token{Type: EOF, Line: line, Lexeme: "EOF"}
+}
+
+func generateStrToken(line int, lexeme string, literal string) Token {
+	return Token{Type: String, Line: line, Lexeme: lexeme, Literal: NewStringLiteral(literal)}
+}
+
+func generateStringInterpToken(line int, lexeme string, literal string) Token {
+	return Token{Type: StringInterp, Line: line, Lexeme: lexeme, Literal: NewStringLiteral(literal)}
+}
+
+func generateNumberToken(line int, literal float64, lexeme string) Token {
+	return Token{Type: Number, Line: line, Lexeme: lexeme, Literal: NewNumberLiteral(literal)}
+}
+
+func generateIdentifierToken(line int, lexeme string) Token {
+	return Token{Type: Identifier, Line: line, Lexeme: lexeme}
+}
+
+func generateKeywordToken(line int, lexeme string) Token {
+	return Token{Type: Keyword, Line: line, Lexeme: lexeme}
+}
+
+func generateToken(tokenType TokenType, line int) Token {
+	return Token{Type: tokenType, Line: line, Lexeme: string(tokenType)}
+}
+
+var UnexpectedTokenError = errors.New("unexpected token")
+var UnterminatedStringError = errors.New("unterminated string")
+
+func getTokenByType(src string, lineNumber int, offset int, target TokenType) (Token, error) {
+	for i := 0; i < len(target); i++ {
+		if offset+i >= len(src) {
+			return Token{}, UnexpectedTokenError
+		}
+
+		if src[offset+i] != target[i] {
+			return Token{}, UnexpectedTokenError
+		}
+	}
+
+	return generateToken(target, lineNumber), nil
+}
+
+func matchNextChar(src string, offset int, target byte) bool {
+	if offset+1 >= len(src) {
+		return false
+	}
+
+	return src[offset+1] == target
+}
+
+func countSkipLineComment(src string, offset int) int {
+	if end := strings.IndexByte(src[offset:], '\n'); end >= 0 {
+		return end
+	}
+	return len(src) - offset
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isAlpha reports whether c can start a name. As in jlox, names are ASCII.
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isComment(src string, offset int) bool {
+	return src[offset] == '/' && matchNextChar(src, offset, '/')
+}
+
+// getStringLiteral reads a string piece starting at the opening quote, or at the '}' closing an
+// interpolated expression. It stops at the closing quote or at the next "${", in which case
+// interpolated is true. "$${" is an escaped "${": it reads as "${" without starting an
+// interpolation. Strings can span lines. The lexeme and, unless it has CRLF line breaks or
+// escapes, the literal are slices of src.
+func getStringLiteral(src string, offset int) (lexeme string, literal string, interpolated bool, count int, err error) {
+	escaped := false
+	for i := offset + 1; ; i++ {
+		if i >= len(src) {
+			return "", "", false, i - offset + 1, UnterminatedStringError
+		}
+
+		if src[i] == '"' {
+			return src[offset : i+1], stringContents(src[offset+1:i], escaped), false, i - offset + 1, nil
+		}
+
+		if src[i] == '$' && strings.HasPrefix(src[i+1:], "${") {
+			escaped = true
+			i += 2
+			continue
+		}
+
+		if src[i] == '$' && matchNextChar(src, i, '{') {
+			return src[offset : i+2], stringContents(src[offset+1:i], escaped), true, i - offset + 2, nil
+		}
+	}
+}
+
+// stringContents reads CRLF line breaks inside a string as plain newlines and, if escaped is set,
+// "$${" as "${".
+func stringContents(raw string, escaped bool) string {
+	if escaped {
+		raw = strings.ReplaceAll(raw, "$${", "${")
+	}
+	if !strings.Contains(raw, "\r\n") {
+		return raw
+	}
+	return strings.ReplaceAll(raw, "\r\n", "\n")
+}
+
+// EscapeString writes the contents of a string the way they appear between its quotes, escaping
+// "${" so that it doesn't start an interpolation.
+func EscapeString(contents string) string {
+	return strings.ReplaceAll(contents, "${", "$${")
+}
+
+func getStringToken(src string, lineNumber int, offset int) (Token, int, error) {
+	lexeme, literal, interpolated, count, err := getStringLiteral(src, offset)
+	if err != nil {
+		return Token{}, count, err
+	}
+
+	if interpolated {
+		return generateStringInterpToken(lineNumber, lexeme, literal), count, nil
+	}
+	return generateStrToken(lineNumber, lexeme, literal), count, nil
+}
+
+// getNumberLiteral reads digits with at most one '.', which must have digits after it: in "1." the
+// dot is a token of its own.
+func getNumberLiteral(src string, offset int) (float64, string, int, error) {
+	i := offset
+	dot := false
+	func() {
+		for ; i < len(src); i++ {
+			switch {
+			case isDigit(src[i]):
+			case src[i] == '.' && !dot && i+1 < len(src) && isDigit(src[i+1]):
+				dot = true
+			default:
+				return
+			}
+		}
+	}()
+
+	rawResult := src[offset:i]
+	result, err := strconv.ParseFloat(rawResult, 64)
+	if err != nil {
+		return 0.0, rawResult, i - offset, errors.New("error converting target to number")
+	}
+	return result, rawResult, i - offset, nil
+}
+
+func getIdentifier(src string, offset int) (string, int) {
+	i := offset
+	for i < len(src) && (isDigit(src[i]) || isAlpha(src[i])) {
+		i++
+	}
+	return src[offset:i], i - offset
+}
+
+func getToken(src string, lineNumber int, offset int) (Token, int, error) {
+	switch {
+	case src[offset] == '(':
+		token := generateToken(LeftParen, lineNumber)
+		return token, 1, nil
+	case src[offset] == ')':
+		token := generateToken(RightParen, lineNumber)
+		return token, 1, nil
+	case src[offset] == '{':
+		token := generateToken(LeftBrace, lineNumber)
+		return token, 1, nil
+	case src[offset] == '}':
+		token := generateToken(RightBrace, lineNumber)
+		return token, 1, nil
+	case src[offset] == '[':
+		token := generateToken(LeftBracket, lineNumber)
+		return token, 1, nil
+	case src[offset] == ']':
+		token := generateToken(RightBracket, lineNumber)
+		return token, 1, nil
+	case src[offset] == '*':
+		token := generateToken(Star, lineNumber)
+		return token, 1, nil
+	case src[offset] == '.':
+		token := generateToken(Dot, lineNumber)
+		return token, 1, nil
+	case src[offset] == ',':
+		token := generateToken(Comma, lineNumber)
+		return token, 1, nil
+	case src[offset] == '+':
+		token := generateToken(Plus, lineNumber)
+		return token, 1, nil
+	case src[offset] == '-':
+		token := generateToken(Minus, lineNumber)
+		return token, 1, nil
+	case src[offset] == ';':
+		token := generateToken(Semicolon, lineNumber)
+		return token, 1, nil
+	case src[offset] == ':':
+		token := generateToken(Colon, lineNumber)
+		return token, 1, nil
+	case src[offset] == '=':
+		token, err := getTokenByType(src, lineNumber, offset, EqualEqual)
+		if err != nil {
+			return generateToken(Equal, lineNumber), 1, nil
+		}
+		return token, len(token.Lexeme), nil
+	case src[offset] == '!':
+		token, err := getTokenByType(src, lineNumber, offset, BangEqual)
+		if err != nil {
+			return generateToken(Bang, lineNumber), 1, nil
+		}
+		return token, len(token.Lexeme), nil
+	case src[offset] == '<':
+		token, err := getTokenByType(src, lineNumber, offset, LessEqual)
+		if err != nil {
+			return generateToken(Less, lineNumber), 1, nil
+		}
+		return token, len(token.Lexeme), nil
+	case src[offset] == '>':
+		token, err := getTokenByType(src, lineNumber, offset, GreaterEqual)
+		if err != nil {
+			return generateToken(Greater, lineNumber), 1, nil
+		}
+		return token, len(token.Lexeme), nil
+	case src[offset] == '/':
+		return generateToken(Slash, lineNumber), 1, nil
+	case src[offset] == '"':
+		return getStringToken(src, lineNumber, offset)
+	case isDigit(src[offset]):
+		number, lexeme, count, err := getNumberLiteral(src, offset)
+		if err != nil {
+			return Token{}, count, err
+		}
+		return generateNumberToken(lineNumber, number, lexeme), count, nil
+	case isAlpha(src[offset]):
+		target, count := getIdentifier(src, offset)
+		if _, isKeyword := keywords[target]; isKeyword {
+			return generateKeywordToken(lineNumber, target), count, nil
+		}
+
+		return generateIdentifierToken(lineNumber, target), count, nil
+	default:
+		// A character outside ASCII is reported whole, not byte by byte
+		_, size := utf8.DecodeRuneInString(src[offset:])
+		return Token{}, size, UnexpectedTokenError
+	}
+}
+
+var TokenScanError = errors.New("token scan error")
+
+const utf8BOM = "\xef\xbb\xbf"
+
+// Scanner pulls tokens from a source one at a time. The source is read whole on the first call to
+// Next, so tokens can span lines, and kept as one string that lexemes are slices of.
+type Scanner struct {
+	ctx    context.Context
+	reader *bufio.Reader
+	src    string
+	loaded bool
+	// Offset of the next token, and the 1-based number and offset of the line it is on
+	offset     int
+	lineNumber int
+	lineStart  int
+	// Line last checked for cancellation
+	checkedLine int
+	// The EOF token was returned
+	done bool
+	// Brace depth inside each open string interpolation, innermost last
+	interpolations []int
+}
+
+// NewScanner creates a scanner over reader. Scanning stops with ctx's error once ctx is done.
+func NewScanner(ctx context.Context, reader *bufio.Reader) *Scanner {
+	return &Scanner{ctx: ctx, reader: reader, lineNumber: 1}
+}
+
+// Reset makes s scan reader from the start, as if it was new. The interpolation stack is
+// emptied, but its storage is kept for reuse. Together with AppendTokens this lets one scanner and one token slice serve many sources in
+// turn.
+func (s *Scanner) Reset(ctx context.Context, reader *bufio.Reader) {
+	*s = Scanner{
+		ctx:            ctx,
+		reader:         reader,
+		lineNumber:     1,
+		interpolations: s.interpolations[:0],
+	}
+}
+
+func newDiagnostic(code string, line int, column int, length int, message string) *diag.Diagnostic {
+	return &diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     code,
+		Message:  message,
+		Line:     line,
+		Column:   column,
+		Length:   length,
+	}
+}
+
+// load reads the whole source unless it already has been.
+func (s *Scanner) load() error {
+	if s.loaded {
+		return nil
+	}
+	src, err := io.ReadAll(s.reader)
+	if err != nil {
+		return fmt.Errorf("error reading source: %w", err)
+	}
+	s.src, s.loaded, s.checkedLine = string(src), true, 0
+	// A UTF-8 byte order mark is not part of the first line
+	if strings.HasPrefix(s.src, utf8BOM) {
+		s.offset, s.lineStart = len(utf8BOM), len(utf8BOM)
+	}
+	return nil
+}
+
+// advance moves past count bytes. It is the only place that counts lines.
+func (s *Scanner) advance(count int) {
+	end := min(s.offset+count, len(s.src))
+	for i := s.offset; i < end; i++ {
+		if s.src[i] == '\n' {
+			s.lineNumber++
+			s.lineStart = i + 1
+		}
+	}
+	s.offset = end
+}
+
+// column is the 1-based column of offset, which is on the current line.
+func (s *Scanner) column(offset int) int {
+	return offset - s.lineStart + 1
+}
+
+// Next returns the next token, and an EOF token for every call once the source is exhausted. The
+// end of the source ends the last line like a newline would, and the EOF token is on the line
+// where the source ends: the line after a trailing newline, as in jlox, and line 1 when the
+// source is empty. A problem in the source is returned as a *diag.Diagnostic error, after which
+// scanning can go on with the following call. Any other error ends scanning.
+func (s *Scanner) Next() (Token, error) {
+	if err := s.load(); err != nil {
+		return Token{}, err
+	}
+
+	for {
+		if s.done {
+			return NewEOFToken(s.lineNumber), nil
+		}
+		if s.lineNumber != s.checkedLine {
+			if err := s.ctx.Err(); err != nil {
+				return Token{}, err
+			}
+			s.checkedLine = s.lineNumber
+		}
+
+		if s.offset >= len(s.src) {
+			if len(s.interpolations) > 0 {
+				s.interpolations = nil
+				return Token{}, newDiagnostic(diag.UnterminatedString, s.lineNumber, s.column(s.offset), 0, "Unterminated string.")
+			}
+			s.done = true
+			continue
+		}
+
+		src, offset := s.src, s.offset
+		// Handle line comments
+		if isComment(src, offset) {
+			s.advance(countSkipLineComment(src, offset))
+			continue
+		}
+
+		// Handle spaces
+		if isSpace(src[offset]) {
+			s.advance(1)
+			continue
+		}
+
+		var token Token
+		var count int
+		var err error
+		if len(s.interpolations) > 0 && src[offset] == '}' && s.interpolations[len(s.interpolations)-1] == 0 {
+			// The embedded expression is closed, resume the string it belongs to
+			s.interpolations = s.interpolations[:len(s.interpolations)-1]
+			token, count, err = getStringToken(src, s.lineNumber, offset)
+		} else {
+			token, count, err = getToken(src, s.lineNumber, offset)
+		}
+		line, column := s.lineNumber, s.column(offset)
+		s.advance(count)
+		if err != nil {
+			if errors.Is(err, UnexpectedTokenError) {
+				return Token{}, newDiagnostic(diag.UnexpectedCharacter, line, column, count, fmt.Sprintf("Unexpected character: %s", src[offset:offset+count]))
+			}
+			if errors.Is(err, UnterminatedStringError) {
+				// Only the part of the string on its first line is marked
+				unterminated := src[offset:min(offset+count, len(src))]
+				length := strings.IndexAny(unterminated, "\r\n")
+				if length < 0 {
+					length = len(unterminated)
+				}
+				return Token{}, newDiagnostic(diag.UnterminatedString, line, column, length, "Unterminated string.")
+			}
+			return Token{}, fmt.Errorf("unexpected error processing token: %w", err)
+		}
+
+		switch {
+		case token.Type == StringInterp:
+			s.interpolations = append(s.interpolations, 0)
+		case token.Type == LeftBrace && len(s.interpolations) > 0:
+			s.interpolations[len(s.interpolations)-1]++
+		case token.Type == RightBrace && len(s.interpolations) > 0:
+			s.interpolations[len(s.interpolations)-1]--
+		}
+		token.Column, token.Offset = column, offset
+		return token, nil
+	}
+}
+
+// Scan tokenizes everything read from reader. Scanning continues past errors: the tokens scanned
+// are returned along with an error matching TokenScanError that wraps a diag.Diagnostic for each
+// problem found.
+func Scan(ctx context.Context, reader *bufio.Reader) ([]Token, error) {
+	return NewScanner(ctx, reader).ScanAll()
+}
+
+// The token slice is sized up front at one token per bytesPerToken bytes of source, at most
+// maxPreallocatedTokens. A token is several times larger than the bytes it covers, so the
+// estimate errs low and is capped; append grows the slice past it when needed.
+const (
+	bytesPerToken         = 16
+	maxPreallocatedTokens = 1 << 14
+)
+
+// ScanAll returns the tokens left in s's source, like Scan. The token slice is sized from the
+// length of the source up front, so it rarely has to grow much.
+func (s *Scanner) ScanAll() ([]Token, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.AppendTokens(make([]Token, 0, min((len(s.src)-s.offset)/bytesPerToken+1, maxPreallocatedTokens)))
+}
+
+// AppendTokens appends the tokens left in s's source to tokens and returns the result, reporting
+// errors like Scan. Passing the slice from an earlier scan, truncated to length 0, reuses its
+// storage once its tokens are no longer needed.
+func (s *Scanner) AppendTokens(tokens []Token) ([]Token, error) {
+	diagnostics := make([]error, 0)
+	for {
+		token, err := s.Next()
+		var diagnostic *diag.Diagnostic
+		if errors.As(err, &diagnostic) {
+			diagnostics = append(diagnostics, diagnostic)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		if token.Type == EOF {
+			break
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return tokens, fmt.Errorf("%w: %w", TokenScanError, errors.Join(diagnostics...))
+	}
+
+	return tokens, nil
+}
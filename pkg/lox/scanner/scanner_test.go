@@ -0,0 +1,274 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/pkg/lox/diag"
+)
+
+// scan tokenizes src, returning the tokens as tokenize prints them, without the EOF, and the
+// diagnostics found.
+func scan(t *testing.T, src string) ([]string, []*diag.Diagnostic) {
+	t.Helper()
+	tokens, err := Scan(context.Background(), bufio.NewReader(strings.NewReader(src)))
+	printed := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Type != EOF {
+			printed = append(printed, token.String())
+		}
+	}
+	return printed, diag.Diagnostics(err)
+}
+
+func TestInterpolation(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`"a${b}c"`, []string{`INTERPOLATION "a${ a`, "IDENTIFIER b null", `STRING }c" c`}},
+		{`"${"${x}"}"`, []string{`INTERPOLATION "${ `, `INTERPOLATION "${ `, "IDENTIFIER x null", `STRING }" `, `STRING }" `}},
+		{`"${ {1: 2}[1] }"`, []string{
+			`INTERPOLATION "${ `, "LEFT_BRACE { null", "NUMBER 1 1.0", "COLON : null", "NUMBER 2 2.0",
+			"RIGHT_BRACE } null", "LEFT_BRACKET [ null", "NUMBER 1 1.0", "RIGHT_BRACKET ] null", `STRING }" `,
+		}},
+		{`"cost: $${1}"`, []string{`STRING "cost: $${1}" cost: ${1}`}},
+		{`"$$${x}"`, []string{`STRING "$$${x}" $${x}`}},
+		{`"$$${x}${y}"`, []string{`INTERPOLATION "$$${x}${ $${x}`, "IDENTIFIER y null", `STRING }" `}},
+		{`"$$ and $"`, []string{`STRING "$$ and $" $$ and $`}},
+	}
+	for _, test := range tests {
+		got, diagnostics := scan(t, test.src)
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: unexpected errors %v", test.src, diagnostics)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %q\nwant %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestUnterminatedInterpolation(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{`"a${b`, 1, 6},
+		{`"a${b}`, 1, 6},
+		{"\"a${\nb", 2, 2},
+		{`"$${b}`, 1, 1},
+	}
+	for _, test := range tests {
+		_, diagnostics := scan(t, test.src)
+		if len(diagnostics) != 1 {
+			t.Errorf("%s: got %d errors, want 1", test.src, len(diagnostics))
+			continue
+		}
+		got := diagnostics[0]
+		if got.Code != diag.UnterminatedString || got.Line != test.line || got.Column != test.column {
+			t.Errorf("%s: got %s at %d:%d, want %s at %d:%d",
+				test.src, got.Code, got.Line, got.Column, diag.UnterminatedString, test.line, test.column)
+		}
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	for _, contents := range []string{"", "plain", "${x}", "$${x}", "$", "a$", "{}"} {
+		src := `"` + EscapeString(contents) + `"`
+		tokens, err := Scan(context.Background(), bufio.NewReader(strings.NewReader(src)))
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if got, _ := tokens[0].Literal.Text(); tokens[0].Type != String || got != contents {
+			t.Errorf("%q: got %s %q, want STRING %q", src, tokens[0].Type, got, contents)
+		}
+	}
+}
+
+func TestScanTokens(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"", []string{}},
+		{"(){}[]*,+.-;:", []string{
+			"LEFT_PAREN ( null", "RIGHT_PAREN ) null", "LEFT_BRACE { null", "RIGHT_BRACE } null",
+			"LEFT_BRACKET [ null", "RIGHT_BRACKET ] null", "STAR * null", "COMMA , null", "PLUS + null",
+			"DOT . null", "MINUS - null", "SEMICOLON ; null", "COLON : null",
+		}},
+		{"= == ! != < <= > >= / ===", []string{
+			"EQUAL = null", "EQUAL_EQUAL == null", "BANG ! null", "BANG_EQUAL != null", "LESS < null",
+			"LESS_EQUAL <= null", "GREATER > null", "GREATER_EQUAL >= null", "SLASH / null",
+			"EQUAL_EQUAL == null", "EQUAL = null",
+		}},
+		{"123 1.5 007 0.25", []string{"NUMBER 123 123.0", "NUMBER 1.5 1.5", "NUMBER 007 7.0", "NUMBER 0.25 0.25"}},
+		{"1. .5 1.2.3", []string{
+			"NUMBER 1 1.0", "DOT . null", "DOT . null", "NUMBER 5 5.0", "NUMBER 1.2 1.2", "DOT . null", "NUMBER 3 3.0",
+		}},
+		{`"" "a b" "multi` + "\n" + `line"`, []string{`STRING "" `, `STRING "a b" a b`, "STRING \"multi\nline\" multi\nline"}},
+		{"\"crlf\r\nline\"", []string{"STRING \"crlf\r\nline\" crlf\nline"}},
+		{`"// not a comment"`, []string{`STRING "// not a comment" // not a comment`}},
+		{"and or nil true false print", []string{
+			"AND and null", "OR or null", "NIL nil null", "TRUE true null", "FALSE false null", "PRINT print null",
+		}},
+		{"orchid _a1 nil2 A_B", []string{"IDENTIFIER orchid null", "IDENTIFIER _a1 null", "IDENTIFIER nil2 null", "IDENTIFIER A_B null"}},
+		{"1 // comment ( @\n/ 2", []string{"NUMBER 1 1.0", "SLASH / null", "NUMBER 2 2.0"}},
+		{" \t\r\n1\r\n", []string{"NUMBER 1 1.0"}},
+		{"\ufeff1", []string{"NUMBER 1 1.0"}},
+	}
+	for _, test := range tests {
+		got, diagnostics := scan(t, test.src)
+		if len(diagnostics) > 0 {
+			t.Errorf("%q: unexpected errors %v", test.src, diagnostics)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q:\n got %q\nwant %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	type problem struct {
+		code         string
+		message      string
+		line, column int
+		length       int
+	}
+	tests := []struct {
+		src      string
+		tokens   []string
+		problems []problem
+	}{
+		{"1 @ 2", []string{"NUMBER 1 1.0", "NUMBER 2 2.0"}, []problem{
+			{diag.UnexpectedCharacter, "Unexpected character: @", 1, 3, 1},
+		}},
+		{"#\n$ é", []string{}, []problem{
+			{diag.UnexpectedCharacter, "Unexpected character: #", 1, 1, 1},
+			{diag.UnexpectedCharacter, "Unexpected character: $", 2, 1, 1},
+			{diag.UnexpectedCharacter, "Unexpected character: é", 2, 3, 2},
+		}},
+		{`1 "open`, []string{"NUMBER 1 1.0"}, []problem{
+			{diag.UnterminatedString, "Unterminated string.", 1, 3, 5},
+		}},
+		{"\"open\nmore", []string{}, []problem{
+			{diag.UnterminatedString, "Unterminated string.", 1, 1, 5},
+		}},
+	}
+	for _, test := range tests {
+		got, diagnostics := scan(t, test.src)
+		if !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%q: got tokens %q, want %q", test.src, got, test.tokens)
+		}
+		problems := make([]problem, 0, len(diagnostics))
+		for _, d := range diagnostics {
+			problems = append(problems, problem{d.Code, d.Message, d.Line, d.Column, d.Length})
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%q:\n got %v\nwant %v", test.src, problems, test.problems)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	tests := []struct {
+		src string
+		// Line and column of each token, the EOF last
+		want [][2]int
+	}{
+		{"", [][2]int{{1, 0}}},
+		{"1", [][2]int{{1, 1}, {1, 0}}},
+		{"1\n", [][2]int{{1, 1}, {2, 0}}},
+		{"  a +\n\tb", [][2]int{{1, 3}, {1, 5}, {2, 2}, {2, 0}}},
+		{"\"a\nb\" c", [][2]int{{1, 1}, {2, 4}, {2, 0}}},
+		{"a\r\nb\r\n", [][2]int{{1, 1}, {2, 1}, {3, 0}}},
+		{"\ufeffa b", [][2]int{{1, 1}, {1, 3}, {1, 0}}},
+		{"// only\n// comments", [][2]int{{2, 0}}},
+		{`"x${y}z"`, [][2]int{{1, 1}, {1, 5}, {1, 6}, {1, 0}}},
+	}
+	for _, test := range tests {
+		tokens, err := Scan(context.Background(), bufio.NewReader(strings.NewReader(test.src)))
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		got := make([][2]int, 0, len(tokens))
+		for _, token := range tokens {
+			got = append(got, [2]int{token.Line, token.Column})
+			// Lexemes are the source they were scanned from
+			if token.Type != EOF && test.src[token.Offset:token.Offset+len(token.Lexeme)] != token.Lexeme {
+				t.Errorf("%q: %s is at offset %d, where the source doesn't have it", test.src, token, token.Offset)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	tokens, err := Scan(context.Background(), bufio.NewReader(strings.NewReader(`12.5 "s" x`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number, ok := tokens[0].Literal.Number(); !ok || number != 12.5 {
+		t.Errorf("got number %v, %v, want 12.5", number, ok)
+	}
+	if _, ok := tokens[0].Literal.Text(); ok {
+		t.Error("a number literal has text")
+	}
+	if text, ok := tokens[1].Literal.Text(); !ok || text != "s" {
+		t.Errorf("got text %q, %v, want s", text, ok)
+	}
+	for _, token := range tokens[2:] {
+		_, isNumber := token.Literal.Number()
+		_, isText := token.Literal.Text()
+		if isNumber || isText || token.Literal.String() != "null" {
+			t.Errorf("%s has a literal", token)
+		}
+	}
+}
+
+// TestScannerReuse checks that Next gives the tokens Scan does, and that a reset scanner and a
+// reused token slice scan a second source as if they were new.
+func TestScannerReuse(t *testing.T) {
+	sources := []string{`"a${ {1: 2}`, "1 + 2\n", `"x${y}" @`}
+	var scanner *Scanner
+	tokens := make([]Token, 0)
+	for _, src := range sources {
+		want, wantErr := Scan(context.Background(), bufio.NewReader(strings.NewReader(src)))
+
+		if scanner == nil {
+			scanner = NewScanner(context.Background(), bufio.NewReader(strings.NewReader(src)))
+		} else {
+			scanner.Reset(context.Background(), bufio.NewReader(strings.NewReader(src)))
+		}
+		var err error
+		tokens, err = scanner.AppendTokens(tokens[:0])
+		if !reflect.DeepEqual(tokens, want) || (err == nil) != (wantErr == nil) {
+			t.Errorf("%q: AppendTokens gave %v, %v, want %v, %v", src, tokens, err, want, wantErr)
+		}
+
+		next := NewScanner(context.Background(), bufio.NewReader(strings.NewReader(src)))
+		pulled := make([]Token, 0)
+		for {
+			token, err := next.Next()
+			if err != nil {
+				continue
+			}
+			pulled = append(pulled, token)
+			if token.Type == EOF {
+				break
+			}
+		}
+		if !reflect.DeepEqual(pulled, want) {
+			t.Errorf("%q: Next gave %v, want %v", src, pulled, want)
+		}
+	}
+}